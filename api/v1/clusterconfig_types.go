@@ -0,0 +1,70 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterConfigSpec defines the desired state of ClusterConfig
+type ClusterConfigSpec struct {
+	ConfigSpec `json:",inline"`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="targetNamespace is immutable"
+	// The namespace the secrets, the AppProject and the bootstrap Application are written to,
+	// the operator must watch it. It can not be changed, the outputs would be left behind in
+	// the previous namespace.
+	TargetNamespace string `json:"targetNamespace"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterConfig is a cluster scoped Config for platform teams writing its outputs into an
+// explicit target namespace, e.g. the one of ArgoCD
+type ClusterConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterConfigSpec `json:"spec,omitempty"`
+	Status ConfigStatus      `json:"status,omitempty"`
+}
+
+// Config returns the ClusterConfig as a Config living in the target namespace
+func (c *ClusterConfig) Config() *Config {
+	config := &Config{
+		ObjectMeta: *c.ObjectMeta.DeepCopy(),
+		Spec:       *c.Spec.ConfigSpec.DeepCopy(),
+		Status:     *c.Status.DeepCopy(),
+	}
+	config.Namespace = c.Spec.TargetNamespace
+	return config
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterConfigList contains a list of ClusterConfig
+type ClusterConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterConfig{}, &ClusterConfigList{})
+}
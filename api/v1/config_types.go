@@ -20,6 +20,37 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// annotations to operate on a config
+const (
+	// RevokeAnnotation revokes the issued credentials, every new value triggers a revocation
+	RevokeAnnotation = "configs.customer.gardener/revoke"
+	// RevokeAcknowledgedAnnotation set to the value of the revoke annotation allows issuing credentials again
+	RevokeAcknowledgedAnnotation = "configs.customer.gardener/revoke-acknowledged"
+)
+
+// label marking the secrets and AppProjects created by the operator,
+// only those are adopted by new configs
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "gardener-config-operator"
+	// AdoptAnnotation set to "true" on an existing secret lets the operator take it over,
+	// foreign labels and annotations of the secret are kept
+	AdoptAnnotation = "configs.customer.gardener/adopt"
+	// OwnerAnnotation names the config a managed secret belongs to, configs of the same shoot
+	// in one namespace do not take over each other's secret
+	OwnerAnnotation = "configs.customer.gardener/owner"
+)
+
+// deletion policies of a config
+const (
+	// DeletionPolicyDelete removes the secrets, the Vault secret and the AppProject
+	DeletionPolicyDelete = "Delete"
+	// DeletionPolicyOrphan keeps everything, a new config can adopt it
+	DeletionPolicyOrphan = "Orphan"
+	// DeletionPolicyDeleteSecretKeepProject removes the credentials but keeps the AppProject
+	DeletionPolicyDeleteSecretKeepProject = "DeleteSecretKeepProject"
+)
+
 // ConfigSpec defines the desired state of Config
 type ConfigSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -38,15 +69,380 @@ type ConfigSpec struct {
 	// +kubebuilder:default=""
 	// The Cloudprovider where the cluster runs
 	CloudProvider string `json:"cloudprovider,omitempty"`
-	// The Frequency to Generate new Tokens
-	Frequency *metav1.Duration `json:"frequency"`
+	// The Frequency to Generate new Tokens, defaults to the frequency of the operator configuration
+	Frequency *metav1.Duration `json:"frequency,omitempty"`
+	// Additional labels of the generated secret. Values containing "{{" are Go templates
+	// rendered with .Config and .Shoot, e.g. "{{ .Shoot.Region }}"
+	Labels map[string]string `json:"labels,omitempty"`
+	// Additional annotations of the generated secret, templated like the labels
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Label keys of the shoot copied to the generated secret
+	PropagateShootLabels []string `json:"propagateShootLabels,omitempty"`
+	// Annotation keys of the shoot copied to the generated secret
+	PropagateShootAnnotations []string `json:"propagateShootAnnotations,omitempty"`
+	// Additional settings of the ArgoCD cluster secret, only used with ArgoCD output
+	ArgoCD *ArgoCDOutput `json:"argocd,omitempty"`
+	// Write the issued credentials to HashiCorp Vault as well
+	Vault *VaultOutput `json:"vault,omitempty"`
+	// The AppProject generated for the shoot, only used with ArgoCD output
+	AppProject *AppProjectSpec `json:"appProject,omitempty"`
+	// An Application deploying baseline workloads to the shoot, created in the AppProject
+	// of the config, only used with ArgoCD output
+	Bootstrap *Bootstrap `json:"bootstrap,omitempty"`
+	// +kubebuilder:validation:Enum=Delete;Orphan;DeleteSecretKeepProject
+	// +kubebuilder:default=Delete
+	// What happens to the generated objects when the config is deleted
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// Stop rotation and cleanup, the existing secrets and AppProject are kept as they are
+	// and a deletion waits until the config is resumed
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// AppProjectSpec defines the AppProject generated for the config
+type AppProjectSpec struct {
+	// The name of the project, configs with the same name share one project. Defaults to the
+	// customer id within the shoot name.
+	Name string `json:"name,omitempty"`
+	// Roles of the project, a default role with access to all applications is used if empty
+	Roles []ProjectRole `json:"roles,omitempty"`
+	// The ArgoCD API used to issue role tokens, defaults to the remote ArgoCD of the config
+	API *ArgoCDRemote `json:"api,omitempty"`
+	// Block syncs to the shoot during its maintenance time window
+	MaintenanceWindow *MaintenanceSyncWindow `json:"maintenanceWindow,omitempty"`
+}
+
+// MaintenanceSyncWindow turns the maintenance time window of the shoot into a sync window of
+// the AppProject, limited to the destination of the shoot
+type MaintenanceSyncWindow struct {
+	// +kubebuilder:validation:Enum=Deny;Manual
+	// +kubebuilder:default=Deny
+	// Deny blocks all syncs, Manual still allows manual syncs during the window
+	Mode string `json:"mode,omitempty"`
+}
+
+// ProjectRole is a role of the AppProject
+type ProjectRole struct {
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// The permissions of the role within the project
+	Policies []ProjectPolicy `json:"policies,omitempty"`
+	// OIDC groups bound to the role
+	Groups []string `json:"groups,omitempty"`
+	// Issue a JWT token for the role and store it in a secret
+	Token *ProjectRoleToken `json:"token,omitempty"`
+}
+
+// ProjectPolicy grants or denies an action on objects of the project
+type ProjectPolicy struct {
+	// +kubebuilder:validation:Enum=applications;applicationsets;logs;exec;repositories;clusters
+	Resource string `json:"resource"`
+	// The action, e.g. get, sync, override, action/apps/Deployment/restart or *
+	Action string `json:"action"`
+	// +kubebuilder:default="*"
+	// The objects within the project, e.g. an application name or *
+	Object string `json:"object,omitempty"`
+	// +kubebuilder:validation:Enum=allow;deny
+	// +kubebuilder:default=allow
+	Permission string `json:"permission,omitempty"`
+}
+
+// ProjectRoleToken defines the JWT token issued for a role
+type ProjectRoleToken struct {
+	// The secret in the namespace of the config the token is stored in, key "token"
+	SecretName string `json:"secretName"`
+	// How long the token is valid, a token without expiry is issued if empty.
+	// Tokens are issued again before they expire.
+	ExpiresIn *metav1.Duration `json:"expiresIn,omitempty"`
+}
+
+// Bootstrap defines the source of the bootstrap Application of a shoot
+type Bootstrap struct {
+	// The name of the Application, defaults to <shoot>-bootstrap
+	Name string `json:"name,omitempty"`
+	// The Git or Helm repository
+	RepoURL string `json:"repoURL"`
+	// The directory in the repository
+	Path string `json:"path,omitempty"`
+	// +kubebuilder:default=HEAD
+	// The revision to deploy
+	TargetRevision string `json:"targetRevision,omitempty"`
+	// The default namespace on the shoot
+	Namespace string `json:"namespace,omitempty"`
+	// Sync automatically with pruning and self healing
+	Automated bool `json:"automated,omitempty"`
+}
+
+// VaultOutput writes the content of the generated secret to a Vault KV v2 engine
+type VaultOutput struct {
+	// The Vault address, e.g. https://vault.example.com:8200
+	Address string `json:"address"`
+	// The Vault enterprise namespace
+	Namespace string `json:"namespace,omitempty"`
+	// PEM encoded CA used to verify the Vault server
+	CABundle string `json:"caBundle,omitempty"`
+	// +kubebuilder:default=secret
+	// The mount path of the KV v2 engine
+	Mount string `json:"mount,omitempty"`
+	// The path of the secret in the engine below <namespace>/, defaults to the shoot. Absolute
+	// paths and .. segments are refused.
+	Path string `json:"path,omitempty"`
+	// How the operator authenticates at Vault
+	Auth VaultAuth `json:"auth"`
+	// Do not create the Kubernetes secret, Vault is the only output
+	SkipSecret bool `json:"skipSecret,omitempty"`
+}
+
+// VaultAuth defines the Vault authentication, exactly one method has to be set
+type VaultAuth struct {
+	// A Vault token stored in a secret in the namespace of the config
+	TokenSecretRef *SecretKeyRef `json:"tokenSecretRef,omitempty"`
+	// Login with the service account of the operator, only at the Vault addresses and with the
+	// roles allowed in the operator configuration
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+}
+
+// SecretKeyRef selects a key of a secret in the namespace of the config
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// VaultKubernetesAuth defines a login at the Vault kubernetes auth method
+type VaultKubernetesAuth struct {
+	// The Vault role to login with
+	Role string `json:"role"`
+	// +kubebuilder:default=kubernetes
+	// The mount path of the auth method
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// ArgoCDOutput defines the optional fields of an ArgoCD cluster secret
+type ArgoCDOutput struct {
+	// The Namespaces ArgoCD may deploy to, all namespaces if empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Allow cluster scoped resources when the cluster is restricted to namespaces
+	ClusterResources bool `json:"clusterResources,omitempty"`
+	// The AppProject the cluster is scoped to
+	Project string `json:"project,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// The application controller shard managing the cluster
+	Shard *int64 `json:"shard,omitempty"`
+	// The Proxy used to connect to the cluster
+	ProxyURL string `json:"proxyUrl,omitempty"`
+	// Authenticate with an exec provider instead of the issued client certificate
+	ExecProviderConfig *ExecProviderConfig `json:"execProviderConfig,omitempty"`
+	// Authenticate with AWS IAM instead of the issued client certificate
+	AWSAuthConfig *AWSAuthConfig `json:"awsAuthConfig,omitempty"`
+	// Annotations added to the cluster secret, exposed as cluster metadata by ArgoCD,
+	// templated like the labels of the config
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Register the cluster at an ArgoCD in another cluster through its API instead of
+	// writing a local cluster secret
+	Remote *ArgoCDRemote `json:"remote,omitempty"`
+}
+
+// ArgoCDRemote points to the API of a remote ArgoCD instance
+type ArgoCDRemote struct {
+	// The ArgoCD server, e.g. https://argocd.example.com
+	Server string `json:"server"`
+	// PEM encoded CA used to verify the ArgoCD server
+	CABundle string `json:"caBundle,omitempty"`
+	// An ArgoCD API token stored in a secret in the namespace of the config
+	TokenSecretRef SecretKeyRef `json:"tokenSecretRef"`
+}
+
+// ExecProviderConfig is the exec credential plugin configuration of an ArgoCD cluster
+type ExecProviderConfig struct {
+	// The Command to execute
+	Command string `json:"command"`
+	// Arguments passed to the command
+	Args []string `json:"args,omitempty"`
+	// Environment variables set for the command
+	Env map[string]string `json:"env,omitempty"`
+	// The preferred input version of the ExecInfo
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Message shown when the command is missing
+	InstallHint string `json:"installHint,omitempty"`
+}
+
+// AWSAuthConfig is the IAM authentication configuration of an ArgoCD cluster
+type AWSAuthConfig struct {
+	// The EKS cluster name
+	ClusterName string `json:"clusterName,omitempty"`
+	// The IAM role ARN to assume
+	RoleARN string `json:"roleARN,omitempty"`
+	// The AWS profile to use
+	Profile string `json:"profile,omitempty"`
 }
 
+// condition types of a config
+const (
+	// ConditionSuspended is true while reconciliation of the config is suspended
+	ConditionSuspended = "Suspended"
+	// ConditionConflict is true if a secret with the name of the generated one exists
+	// which is not managed by the operator
+	ConditionConflict = "Conflict"
+	// ConditionRotationFailed is true while issuing new credentials fails
+	ConditionRotationFailed = "RotationFailed"
+	// ConditionProjectFailed is true while the AppProject of the config can not be rendered,
+	// e.g. the shoot name holds no customer id and spec.appProject.name is empty
+	ConditionProjectFailed = "ProjectFailed"
+	// ConditionTargetNotWatched is true while the target namespace of a ClusterConfig is not
+	// watched by the operator, nothing is written there
+	ConditionTargetNotWatched = "TargetNotWatched"
+)
+
 // ConfigStatus defines the observed state of Config
 type ConfigStatus struct {
 	Phase           string       `json:"phase,omitempty"`
 	LastUpdatedTime *metav1.Time `json:"lastUpdatedTime,omitempty"`
 	ProjectName     string       `json:"projectName,omitempty"`
+	// Hash of the rendered AppProject, it is only written again if the hash changes
+	ProjectHash string `json:"projectHash,omitempty"`
+	// The destination server the config added to the project
+	ProjectDestination string `json:"projectDestination,omitempty"`
+	// The roles the config added to the project
+	ProjectRoles []string `json:"projectRoles,omitempty"`
+	// The phase of the shoot CA rotation the current credentials were issued in
+	CARotationPhase string `json:"caRotationPhase,omitempty"`
+	// The ArgoCD application controller shard the cluster is assigned to
+	Shard *int64 `json:"shard,omitempty"`
+	// The shoot attributes last read from the garden cluster
+	Shoot *ShootStatus `json:"shoot,omitempty"`
+	// The Vault secret the credentials were written to
+	Vault *VaultStatus `json:"vault,omitempty"`
+	// The credential issued last, matches the records of the audit trail
+	Credential *CredentialStatus `json:"credential,omitempty"`
+	// The cluster registered at a remote ArgoCD
+	Remote *RemoteStatus `json:"remote,omitempty"`
+	// The bootstrap Application created for the shoot
+	Bootstrap *BootstrapStatus `json:"bootstrap,omitempty"`
+	// The last revocation, no credentials are issued until it is acknowledged
+	Revocation *RevocationStatus `json:"revocation,omitempty"`
+	// The removal of the outputs while the config is deleted
+	Cleanup *CleanupStatus `json:"cleanup,omitempty"`
+	// The failed attempts to issue new credentials since the last success
+	Retry *RetryStatus `json:"retry,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// The current state of the config
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// RevocationStatus reports a revocation of the issued credentials
+type RevocationStatus struct {
+	// The value of the revoke annotation
+	ID        string       `json:"id"`
+	RevokedAt *metav1.Time `json:"revokedAt"`
+	// The revoked credential
+	Credential *CredentialStatus `json:"credential,omitempty"`
+	// Wether a credentials rotation of the shoot was started
+	ShootCredentialsRotation bool `json:"shootCredentialsRotation,omitempty"`
+	// +kubebuilder:validation:Enum=Preparing;Completing;Completed
+	// The progress of the credentials rotation of the shoot, the revoked client certificates
+	// stay valid until it is Completed
+	ShootCredentialsRotationPhase string       `json:"shootCredentialsRotationPhase,omitempty"`
+	Acknowledged                  bool         `json:"acknowledged,omitempty"`
+	AcknowledgedAt                *metav1.Time `json:"acknowledgedAt,omitempty"`
+}
+
+// phases of the shoot credentials rotation started by a revocation
+const (
+	RevocationRotationPreparing  = "Preparing"
+	RevocationRotationCompleting = "Completing"
+	RevocationRotationCompleted  = "Completed"
+)
+
+// states of an output during the cleanup of a deleted config
+const (
+	CleanupDeleted = "Deleted"
+	CleanupKept    = "Kept"
+	CleanupFailed  = "Failed"
+)
+
+// CleanupStatus tracks the outputs of a deleted config, the finalizer is removed once
+// no output is left in state Failed
+type CleanupStatus struct {
+	Secret    string `json:"secret,omitempty"`
+	Vault     string `json:"vault,omitempty"`
+	Project   string `json:"project,omitempty"`
+	Remote    string `json:"remote,omitempty"`
+	Bootstrap string `json:"bootstrap,omitempty"`
+	// The error of the last failed cleanup step
+	LastError string `json:"lastError,omitempty"`
+}
+
+// CredentialStatus identifies an issued credential
+type CredentialStatus struct {
+	Type         string       `json:"type"`
+	SerialNumber string       `json:"serialNumber,omitempty"`
+	Fingerprint  string       `json:"fingerprint,omitempty"`
+	NotAfter     *metav1.Time `json:"notAfter,omitempty"`
+}
+
+// RetryStatus tracks failed attempts to issue credentials
+type RetryStatus struct {
+	// Failed attempts since the last issued credentials
+	Attempts int32 `json:"attempts"`
+	// The error of the last attempt
+	LastError string `json:"lastError,omitempty"`
+	// When the last attempt failed
+	LastAttempt *metav1.Time `json:"lastAttempt,omitempty"`
+	// When the next attempt is scheduled
+	NextAttempt *metav1.Time `json:"nextAttempt,omitempty"`
+	// The generation of the config the last attempt failed for, a changed spec is retried at once
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// BootstrapStatus identifies the bootstrap Application of a shoot
+type BootstrapStatus struct {
+	Name string `json:"name"`
+	// Hash of the rendered Application, it is only written again if the hash changes
+	Hash string `json:"hash,omitempty"`
+}
+
+// RemoteStatus identifies the cluster registered at a remote ArgoCD
+type RemoteStatus struct {
+	// The ArgoCD server
+	Server string `json:"server"`
+	// The API server of the shoot the cluster is registered with
+	Cluster string `json:"cluster"`
+}
+
+// VaultStatus points to the Vault secret written for a config
+type VaultStatus struct {
+	Mount   string `json:"mount"`
+	Path    string `json:"path"`
+	Version int64  `json:"version,omitempty"`
+	// The Vault the secret was written to, it is deleted there once the vault section is removed
+	Address   string     `json:"address,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	CABundle  string     `json:"caBundle,omitempty"`
+	Auth      *VaultAuth `json:"auth,omitempty"`
+}
+
+// ShootStatus describes the shoot cluster of a config
+type ShootStatus struct {
+	// The gardener purpose of the shoot
+	Purpose string `json:"purpose,omitempty"`
+	// The stage the purpose and labels of the shoot map to
+	Stage             string   `json:"stage,omitempty"`
+	Region            string   `json:"region,omitempty"`
+	SeedName          string   `json:"seedName,omitempty"`
+	KubernetesVersion string   `json:"kubernetesVersion,omitempty"`
+	Networking        string   `json:"networking,omitempty"`
+	MachineTypes      []string `json:"machineTypes,omitempty"`
+	Zones             []string `json:"zones,omitempty"`
+	// The maintenance time window of the shoot
+	Maintenance *MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// MaintenanceWindow is the daily maintenance time window of a shoot in the gardener format
+// HHMMSS+ZZZZ
+type MaintenanceWindow struct {
+	Begin string `json:"begin"`
+	End   string `json:"end"`
 }
 
 //+kubebuilder:object:root=true
@@ -18,9 +18,9 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -31,11 +31,15 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	clustergardenerv1 "customer.gardener/config/api/v1"
 	"customer.gardener/config/internal/controller"
+	"customer.gardener/config/pkg/audit"
+	"customer.gardener/config/pkg/gardener"
+	"customer.gardener/config/pkg/operatorconfig"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -51,28 +55,19 @@ func init() {
 	//+kubebuilder:scaffold:scheme
 }
 
-func getWatchNamespace() (string, error) {
-	// WatchNamespaceEnvVar is the constant for env variable WATCH_NAMESPACE
-	// which specifies the Namespace to watch.
-	// An empty value means the operator is running with cluster scope.
-	var watchNamespaceEnvVar = "WATCH_NAMESPACE"
-
-	ns, found := os.LookupEnv(watchNamespaceEnvVar)
-	if !found {
-		return "", fmt.Errorf("%s must be set", watchNamespaceEnvVar)
-	}
-	return ns, nil
-}
-
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var configFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&configFile, "config", "",
+		"Path to the operator configuration file, e.g. a mounted ConfigMap. It is reloaded when it changes. "+
+			"Without it the defaults are used.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -81,12 +76,31 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	watchNamespace, err := getWatchNamespace()
-	if err != nil {
-		setupLog.Error(err, "unable to get WatchNamespace, "+
-			"the manager will watch and manage resources in all Namespaces")
+	operatorConfig := operatorconfig.DefaultConfiguration()
+	if configFile != "" {
+		loaded, err := operatorconfig.Load(configFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load operator configuration")
+			os.Exit(1)
+		}
+		operatorConfig = loaded
+	}
+	gardener.SetConnection(operatorConfig.Garden)
+	store := operatorconfig.NewStore(operatorConfig)
+
+	var auditTrail audit.Sink
+	if operatorConfig.AuditSink != "none" {
+		sink, err := audit.NewSink(operatorConfig.AuditSink)
+		if err != nil {
+			setupLog.Error(err, "unable to set up audit trail")
+			os.Exit(1)
+		}
+		auditTrail = sink
 	}
 
+	// an empty list watches all namespaces
+	watchNamespace := strings.Join(operatorConfig.WatchNamespaces, ",")
+
 	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -94,11 +108,12 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "f98ee0fe.customer.gardener",
-		Namespace:              watchNamespace,
+		// the process exits right after the manager stops, in flight garden and ArgoCD
+		// requests are cancelled with the reconcile context before the lease is released
+		LeaderElectionReleaseOnCancel: true,
+		Namespace:                     watchNamespace,
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
-
 	if strings.Contains(watchNamespace, ",") {
 		setupLog.Info("manager set up with multiple namespaces", "namespaces", watchNamespace)
 		// configure cluster-scoped with MultiNamespacedCacheBuilder
@@ -106,18 +121,51 @@ func main() {
 		options.NewCache = cache.MultiNamespacedCacheBuilder(strings.Split(watchNamespace, ","))
 	}
 
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// a changed shard count moves clusters, every config has to be reconciled again
+	configResync := make(chan event.GenericEvent, 1)
+	clusterConfigResync := make(chan event.GenericEvent, 1)
+	if configFile != "" {
+		sharding := operatorConfig.Sharding
+		watcher := operatorconfig.NewWatcher(configFile, 30*time.Second, store, func(c *operatorconfig.OperatorConfiguration) {
+			gardener.SetConnection(c.Garden)
+			if c.Sharding != sharding {
+				sharding = c.Sharding
+				controller.Resync(configResync, clusterConfigResync)
+			}
+		})
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch operator configuration")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controller.ConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Operator: store,
+		Audit:    auditTrail,
+		Resync:   configResync,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Config")
 		os.Exit(1)
 	}
+	if err = (&controller.ClusterConfigReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Operator:        store,
+		Audit:           auditTrail,
+		WatchNamespaces: operatorConfig.WatchNamespaces,
+		Resync:          clusterConfigResync,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterConfig")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
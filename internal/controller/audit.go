@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/audit"
+	"customer.gardener/config/pkg/gardener"
+)
+
+// reasons for issuing credentials in the audit trail
+const (
+	auditReasonCreated    = "created"
+	auditReasonRotation   = "rotation"
+	auditReasonCARotation = "ca-rotation"
+)
+
+// outputTargets lists where the credentials of the config are written to
+func outputTargets(config *customergardenerv1.Config) []string {
+	targets := []string{}
+	if !skipSecret(config) {
+		targets = append(targets, fmt.Sprintf("secret:%s/%s", config.Namespace, gardener.SecretName(config)))
+	}
+	if config.Spec.Vault != nil {
+		if mount, path, err := vaultLocation(config); err == nil {
+			targets = append(targets, fmt.Sprintf("vault:%s/%s", mount, path))
+		}
+	}
+	if remoteArgoCD(config) {
+		targets = append(targets, fmt.Sprintf("argocd:%s/%s", config.Spec.ArgoCD.Remote.Server, config.Spec.Shoot))
+	}
+	return targets
+}
+
+func newAuditRecord(config *customergardenerv1.Config, action string, reason string) audit.Record {
+	return audit.Record{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		Reason:    reason,
+		ConfigUID: string(config.UID),
+		Namespace: config.Namespace,
+		Name:      config.Name,
+		Project:   config.Spec.Project,
+		Shoot:     config.Spec.Shoot,
+		Targets:   outputTargets(config),
+	}
+}
+
+// auditIssue records newly issued credentials in the status and the audit trail,
+// a failing sink is logged but does not undo the issuance
+func (r *ConfigReconciler) auditIssue(ctx context.Context, config *customergardenerv1.Config, secret *v1.Secret, reason string) {
+	reqLogger := log.FromContext(ctx)
+	record := newAuditRecord(config, audit.ActionIssue, reason)
+
+	cert, err := gardener.ClientCertificate(secret)
+	if err != nil {
+		reqLogger.Error(err, "Unable to read issued client certificate")
+	}
+	if cert != nil {
+		record.CredentialType = "client-certificate"
+		record.SerialNumber = cert.SerialNumber
+		record.Fingerprint = cert.Fingerprint
+		record.ExpiresAt = &cert.NotAfter
+		config.Status.Credential = &customergardenerv1.CredentialStatus{
+			Type:         record.CredentialType,
+			SerialNumber: cert.SerialNumber,
+			Fingerprint:  cert.Fingerprint,
+			NotAfter:     &metav1.Time{Time: cert.NotAfter},
+		}
+	} else {
+		record.CredentialType = "kubeconfig"
+		config.Status.Credential = &customergardenerv1.CredentialStatus{Type: record.CredentialType}
+	}
+
+	r.writeAudit(ctx, record)
+}
+
+// auditDelete records the removal of the outputs of the config
+func (r *ConfigReconciler) auditDelete(ctx context.Context, config *customergardenerv1.Config, reason string) {
+	record := newAuditRecord(config, audit.ActionDelete, reason)
+	if cred := config.Status.Credential; cred != nil {
+		record.CredentialType = cred.Type
+		record.SerialNumber = cred.SerialNumber
+		record.Fingerprint = cred.Fingerprint
+	}
+	r.writeAudit(ctx, record)
+}
+
+func (r *ConfigReconciler) writeAudit(ctx context.Context, record audit.Record) {
+	if r.Audit == nil {
+		return
+	}
+	if err := r.Audit.Write(ctx, record); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to write audit record", "action", record.Action)
+	}
+}
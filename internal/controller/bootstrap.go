@@ -0,0 +1,137 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/argocd"
+)
+
+// reconcileBootstrap keeps the bootstrap Application of the shoot in line with the config,
+// server is the API server of the shoot. The Application is only written if its rendered
+// content changed or the live one was edited or deleted, and removed again if the bootstrap
+// section is dropped.
+func (r *ConfigReconciler) reconcileBootstrap(ctx context.Context, config *customergardenerv1.Config, server string) error {
+	if config.Spec.Bootstrap == nil || config.Spec.DesiredOutput != "ArgoCD" {
+		return r.deleteBootstrap(ctx, config)
+	}
+	if config.Status.ProjectName == "" || server == "" {
+		return nil
+	}
+
+	app := argocd.BootstrapApplication(config, config.Status.ProjectName, config.Namespace, server)
+	hash, err := argocd.Hash(app)
+	if err != nil {
+		return err
+	}
+	current := config.Status.Bootstrap
+	if current != nil && current.Name == app.Metadata.Name && current.Hash == hash {
+		live, err := r.liveBootstrap(ctx, config, app.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		if argocd.ApplicationCurrent(live, app) {
+			return nil
+		}
+		log.FromContext(ctx).Info(fmt.Sprintf("Bootstrap Application %s was changed or deleted", app.Metadata.Name))
+	}
+	// the Application was renamed, the old one must not keep deploying
+	if current != nil && current.Name != app.Metadata.Name {
+		if err := r.deleteBootstrap(ctx, config); err != nil {
+			return err
+		}
+	}
+
+	log.FromContext(ctx).Info(fmt.Sprintf("Apply bootstrap Application %s", app.Metadata.Name))
+	if remoteArgoCD(config) {
+		c, err := r.argoCDClient(ctx, config)
+		if err != nil {
+			return err
+		}
+		err = c.UpsertApplication(ctx, app)
+	} else {
+		err = r.applyLocalApplication(ctx, app)
+	}
+	if err != nil {
+		return err
+	}
+	config.Status.Bootstrap = &customergardenerv1.BootstrapStatus{Name: app.Metadata.Name, Hash: hash}
+	return nil
+}
+
+// deleteBootstrap removes the bootstrap Application recorded in the status, the workloads it
+// deployed stay on the shoot
+func (r *ConfigReconciler) deleteBootstrap(ctx context.Context, config *customergardenerv1.Config) error {
+	if config.Status.Bootstrap == nil {
+		return nil
+	}
+	name := config.Status.Bootstrap.Name
+	if remoteArgoCD(config) {
+		c, err := r.argoCDClient(ctx, config)
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteApplication(ctx, name); err != nil {
+			return err
+		}
+	} else if err := r.deleteLocalApplication(ctx, config.Namespace, name); err != nil {
+		return err
+	}
+	config.Status.Bootstrap = nil
+	return nil
+}
+
+// liveBootstrap reads the bootstrap Application from the ArgoCD of the config, nil if it is gone
+func (r *ConfigReconciler) liveBootstrap(ctx context.Context, config *customergardenerv1.Config, name string) (*argocd.Application, error) {
+	if remoteArgoCD(config) {
+		c, err := r.argoCDClient(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return c.GetApplication(ctx, name)
+	}
+	ctx, cancel := r.argoCDContext(ctx)
+	defer cancel()
+	return argocd.GetApplication(ctx, r.Client, config.Namespace, name)
+}
+
+// applyLocalApplication creates or updates the Application where the operator runs
+func (r *ConfigReconciler) applyLocalApplication(ctx context.Context, app argocd.Application) error {
+	ctx, cancel := r.argoCDContext(ctx)
+	defer cancel()
+	return argocd.ApplyApplication(ctx, r.Client, app)
+}
+
+// deleteLocalApplication removes the Application where the operator runs
+func (r *ConfigReconciler) deleteLocalApplication(ctx context.Context, namespace string, name string) error {
+	ctx, cancel := r.argoCDContext(ctx)
+	defer cancel()
+	return argocd.DeleteApplication(ctx, r.Client, namespace, name)
+}
+
+// shootServer returns the API server of the shoot the outputs of the config point to
+func shootServer(config *customergardenerv1.Config, secretServer string) string {
+	if remoteArgoCD(config) && config.Status.Remote != nil {
+		return config.Status.Remote.Cluster
+	}
+	return secretServer
+}
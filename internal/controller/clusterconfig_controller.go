@@ -0,0 +1,214 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/audit"
+	"customer.gardener/config/pkg/operatorconfig"
+)
+
+// ClusterConfigReconciler reconciles ClusterConfigs with the logic of the ConfigReconciler, a
+// ClusterConfig is handled as Config in its target namespace
+type ClusterConfigReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// the operator configuration, reloaded while the operator runs, the defaults are used if nil
+	Operator *operatorconfig.Store
+	// receives a record for every issued and deleted credential, nil disables the audit trail
+	Audit audit.Sink
+	// namespaces watched by the manager, all namespaces if empty
+	WatchNamespaces []string
+	// reconciles all ClusterConfigs on every event, e.g. after the shard count changed
+	Resync <-chan event.GenericEvent
+}
+
+//+kubebuilder:rbac:groups=customer.gardener,resources=clusterconfigs,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=customer.gardener,resources=clusterconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=customer.gardener,resources=clusterconfigs/finalizers,verbs=update
+
+func (r *ClusterConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	clusterConfig := &customergardenerv1.ClusterConfig{}
+	err := r.Client.Get(ctx, req.NamespacedName, clusterConfig)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			suspended.set(req.NamespacedName, false, suspendedConfigs)
+			rotationsAtRisk.set(req.NamespacedName, false, rotationsAtRiskConfigs)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	configs := &ConfigReconciler{
+		Client:   r.Client,
+		Scheme:   r.Scheme,
+		Operator: r.Operator,
+		Audit:    r.Audit,
+		store:    &clusterConfigStore{client: r.Client, object: clusterConfig},
+	}
+	config := clusterConfig.Config()
+
+	// the cache never sees a target outside of the watched namespaces, every reconcile would
+	// issue credentials and fail on the secret it wrote before
+	if !r.watches(config.Namespace) && config.DeletionTimestamp.IsZero() {
+		log.FromContext(ctx).Info(fmt.Sprintf("Target namespace %s is not watched by the operator", config.Namespace))
+		if setCondition(config, customergardenerv1.ConditionTargetNotWatched, metav1.ConditionTrue, "NotWatched",
+			fmt.Sprintf("Target namespace %s is not one of the watched namespaces %s", config.Namespace, strings.Join(r.WatchNamespaces, ","))) {
+			return ctrl.Result{}, configs.updateConfigStatus(ctx, config)
+		}
+		return ctrl.Result{}, nil
+	}
+	setCondition(config, customergardenerv1.ConditionTargetNotWatched, metav1.ConditionFalse, "Watched", "")
+	return configs.reconcile(ctx, config)
+}
+
+// watches reports whether the manager watches the namespace
+func (r *ClusterConfigReconciler) watches(namespace string) bool {
+	return len(r.WatchNamespaces) == 0 || containsString(r.WatchNamespaces, namespace)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&customergardenerv1.ClusterConfig{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Operator.Get().Controller.MaxConcurrentReconciles})
+	if r.Resync != nil {
+		b = b.Watches(&source.Channel{Source: r.Resync}, handler.EnqueueRequestsFromMapFunc(r.allClusterConfigs))
+	}
+	return b.Complete(r)
+}
+
+// allClusterConfigs returns a request for every ClusterConfig, used on a resync
+func (r *ClusterConfigReconciler) allClusterConfigs(client.Object) []reconcile.Request {
+	clusterConfigs := &customergardenerv1.ClusterConfigList{}
+	if err := r.Client.List(context.Background(), clusterConfigs); err != nil {
+		log.Log.Error(err, "Unable to list ClusterConfigs for a resync")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(clusterConfigs.Items))
+	for i := range clusterConfigs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&clusterConfigs.Items[i])})
+	}
+	return requests
+}
+
+// configStore writes the reconciled config back to the object it was read from
+type configStore interface {
+	// the name of the object, used to track it in the metrics
+	key(config *customergardenerv1.Config) types.NamespacedName
+	// writes metadata and spec, the operator only changes the finalizers
+	update(ctx context.Context, config *customergardenerv1.Config) error
+	updateStatus(ctx context.Context, config *customergardenerv1.Config) error
+}
+
+func (r *ConfigReconciler) objects() configStore {
+	if r.store == nil {
+		return &namespacedConfigStore{client: r.Client}
+	}
+	return r.store
+}
+
+func (r *ConfigReconciler) updateConfig(ctx context.Context, config *customergardenerv1.Config) error {
+	return r.objects().update(ctx, config)
+}
+
+func (r *ConfigReconciler) updateConfigStatus(ctx context.Context, config *customergardenerv1.Config) error {
+	return r.objects().updateStatus(ctx, config)
+}
+
+// namespacedConfigStore writes the finalizers and the status of a Config, the spec is never
+// written so operator defaults applied in memory never end up in it
+type namespacedConfigStore struct {
+	client client.Client
+}
+
+func (s *namespacedConfigStore) key(config *customergardenerv1.Config) types.NamespacedName {
+	return client.ObjectKeyFromObject(config)
+}
+
+func (s *namespacedConfigStore) update(ctx context.Context, config *customergardenerv1.Config) error {
+	// the resourceVersion keeps the optimistic locking of an update
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{
+		"finalizers":      config.Finalizers,
+		"resourceVersion": config.ResourceVersion,
+	}})
+	if err != nil {
+		return err
+	}
+	stored := config.DeepCopy()
+	if err := s.client.Patch(ctx, stored, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return err
+	}
+	config.ResourceVersion = stored.ResourceVersion
+	return nil
+}
+
+func (s *namespacedConfigStore) updateStatus(ctx context.Context, config *customergardenerv1.Config) error {
+	// the response carries the stored spec, it must not replace the defaulted one
+	stored := config.DeepCopy()
+	if err := s.client.Status().Update(ctx, stored); err != nil {
+		return err
+	}
+	config.ResourceVersion = stored.ResourceVersion
+	return nil
+}
+
+// clusterConfigStore copies the finalizers and the status of the config into the ClusterConfig,
+// the spec of the ClusterConfig stays as it was read so operator defaults never end up in it
+type clusterConfigStore struct {
+	client client.Client
+	object *customergardenerv1.ClusterConfig
+}
+
+func (s *clusterConfigStore) key(config *customergardenerv1.Config) types.NamespacedName {
+	return client.ObjectKeyFromObject(s.object)
+}
+
+func (s *clusterConfigStore) update(ctx context.Context, config *customergardenerv1.Config) error {
+	s.object.Finalizers = config.Finalizers
+	if err := s.client.Update(ctx, s.object); err != nil {
+		return err
+	}
+	config.ResourceVersion = s.object.ResourceVersion
+	return nil
+}
+
+func (s *clusterConfigStore) updateStatus(ctx context.Context, config *customergardenerv1.Config) error {
+	config.Status.DeepCopyInto(&s.object.Status)
+	if err := s.client.Status().Update(ctx, s.object); err != nil {
+		return err
+	}
+	config.ResourceVersion = s.object.ResourceVersion
+	return nil
+}
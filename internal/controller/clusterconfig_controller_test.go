@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/operatorconfig"
+)
+
+var _ = Describe("ClusterConfig", func() {
+	ctx := context.Background()
+
+	newClusterConfig := func(name string, target string) *customergardenerv1.ClusterConfig {
+		requireEnvtest()
+		clusterConfig := &customergardenerv1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: customergardenerv1.ClusterConfigSpec{
+				ConfigSpec:      customergardenerv1.ConfigSpec{DesiredOutput: "Plain", Project: "abc", Shoot: name},
+				TargetNamespace: target,
+			},
+		}
+		Expect(k8sClient.Create(ctx, clusterConfig)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterConfig), clusterConfig))).To(Succeed())
+			clusterConfig.Finalizers = nil
+			Expect(client.IgnoreNotFound(k8sClient.Update(ctx, clusterConfig))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, clusterConfig))).To(Succeed())
+		})
+		return clusterConfig
+	}
+
+	It("writes nothing into a target namespace the operator does not watch", func() {
+		clusterConfig := newClusterConfig("cluster-unwatched", "kube-public")
+		r := &ClusterConfigReconciler{
+			Client:          k8sClient,
+			Scheme:          scheme.Scheme,
+			Operator:        operatorconfig.NewStore(operatorconfig.DefaultConfiguration()),
+			WatchNamespaces: []string{"default"},
+		}
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(clusterConfig)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterConfig), clusterConfig)).To(Succeed())
+		Expect(clusterConfig.Finalizers).To(BeEmpty())
+		Expect(meta.IsStatusConditionTrue(clusterConfig.Status.Conditions, customergardenerv1.ConditionTargetNotWatched)).To(BeTrue())
+	})
+
+	It("refuses to change the target namespace", func() {
+		clusterConfig := newClusterConfig("cluster-immutable", "default")
+		clusterConfig.Spec.TargetNamespace = "kube-public"
+		Expect(k8sClient.Update(ctx, clusterConfig)).NotTo(Succeed())
+	})
+
+	It("leaves the role tokens of a Config with the same name alone", func() {
+		config := &customergardenerv1.Config{ObjectMeta: metav1.ObjectMeta{Name: "platform", Namespace: "argocd", UID: "config-uid"}}
+		clusterConfig := &customergardenerv1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "platform", UID: "cluster-uid"}}
+		secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			tokenConfigLabel:    "platform",
+			tokenConfigUIDLabel: "config-uid",
+		}}}
+
+		namespaced := &ConfigReconciler{}
+		cluster := &ConfigReconciler{store: &clusterConfigStore{object: clusterConfig}}
+		Expect(namespaced.ownsTokenSecret(config, secret)).To(BeTrue())
+		Expect(cluster.ownsTokenSecret(clusterConfig.Config(), secret)).To(BeFalse())
+
+		// written before the UID label, only the namespaced Config claims it
+		delete(secret.Labels, tokenConfigUIDLabel)
+		Expect(namespaced.ownsTokenSecret(config, secret)).To(BeTrue())
+		Expect(cluster.ownsTokenSecret(clusterConfig.Config(), secret)).To(BeFalse())
+	})
+})
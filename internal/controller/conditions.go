@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+// setCondition updates a condition of the config and reports a change
+func setCondition(config *customergardenerv1.Config, conditionType string, status metav1.ConditionStatus, reason string, message string) bool {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: config.Generation,
+	}
+	existing := meta.FindStatusCondition(config.Status.Conditions, condition.Type)
+	changed := existing == nil || existing.Status != condition.Status || existing.Reason != condition.Reason ||
+		existing.Message != condition.Message || existing.ObservedGeneration != condition.ObservedGeneration
+	meta.SetStatusCondition(&config.Status.Conditions, condition)
+	return changed
+}
+
+// setSuspendedCondition reflects spec.suspend in the conditions and reports a change
+func setSuspendedCondition(config *customergardenerv1.Config) bool {
+	if config.Spec.Suspend {
+		return setCondition(config, customergardenerv1.ConditionSuspended, metav1.ConditionTrue,
+			"Suspended", "Rotation and cleanup are suspended, existing objects are kept")
+	}
+	return setCondition(config, customergardenerv1.ConditionSuspended, metav1.ConditionFalse,
+		"Active", "Credentials are rotated with the configured frequency")
+}
+
+// setConflictCondition reports a foreign secret blocking the generated one
+func setConflictCondition(config *customergardenerv1.Config, secret *v1.Secret, conflict bool) bool {
+	if owner := foreignOwner(config, secret); conflict && owner != "" {
+		return setCondition(config, customergardenerv1.ConditionConflict, metav1.ConditionTrue, "SecretOwnedByOtherConfig",
+			fmt.Sprintf("Secret %s belongs to config %s of the same shoot, only one config may write it",
+				secret.Name, owner))
+	}
+	if conflict {
+		return setCondition(config, customergardenerv1.ConditionConflict, metav1.ConditionTrue, "SecretNotManaged",
+			fmt.Sprintf("Secret %s exists and is not managed by the operator, annotate it with %s=true to adopt it",
+				secret.Name, customergardenerv1.AdoptAnnotation))
+	}
+	return setCondition(config, customergardenerv1.ConditionConflict, metav1.ConditionFalse, "NoConflict", "")
+}
@@ -19,7 +19,8 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strings"
+	"hash/fnv"
+	"math"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
@@ -28,18 +29,41 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	customergardenerv1 "customer.gardener/config/api/v1"
 	"customer.gardener/config/pkg/argocd"
+	"customer.gardener/config/pkg/audit"
 	"customer.gardener/config/pkg/gardener"
+	"customer.gardener/config/pkg/operatorconfig"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// poll interval for the shoot while a CA rotation is in progress
+const caRotationRequeue = 5 * time.Minute
+
+// shortest requeue, keeps a config whose frequency hardly exceeds the skew from rotating in a loop
+const minRequeue = time.Minute
+
 // ConfigReconciler reconciles object
 type ConfigReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// the operator configuration, reloaded while the operator runs, the defaults are used if nil
+	Operator *operatorconfig.Store
+	// receives a record for every issued and deleted credential, nil disables the audit trail
+	Audit audit.Sink
+	// reconciles all Configs on every event, e.g. after the shard count changed
+	Resync <-chan event.GenericEvent
+
+	// where the reconciled config is written back, namespaced Configs if nil
+	store configStore
 }
 
 //+kubebuilder:rbac:groups=customer.gardener,resources=configs,verbs=get;list;watch;create;update;patch;delete
@@ -47,20 +71,78 @@ type ConfigReconciler struct {
 //+kubebuilder:rbac:groups=customer.gardener,resources=configs/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="argoproj.io",resources=appprojects,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="argoproj.io",resources=applications,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=appprojects,verbs=get;list;watch;create;update;patch;delete
 
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
 func (r *ConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	reqLogger := log.FromContext(ctx)
-
 	//Get CRD config object
 	argoCrConfig := &customergardenerv1.Config{}
 
 	err := r.Client.Get(ctx, req.NamespacedName, argoCrConfig)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			suspended.set(req.NamespacedName, false, suspendedConfigs)
+			rotationsAtRisk.set(req.NamespacedName, false, rotationsAtRiskConfigs)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	return r.reconcile(ctx, argoCrConfig)
+}
+
+// reconcile brings the outputs of the config in line with it, shared by Configs and ClusterConfigs
+func (r *ConfigReconciler) reconcile(ctx context.Context, argoCrConfig *customergardenerv1.Config) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	key := r.objects().key(argoCrConfig)
+	// the defaults only live in memory, the store never writes the spec. Revocation and cleanup
+	// need them as well to find the remote ArgoCD and the ArgoCD API of the config.
+	settings := r.Operator.Get()
+	settings.Defaults.Apply(argoCrConfig)
+
+	// a deleted config never gets new credentials while a revocation is pending
+	if revocationBlocked(argoCrConfig) && !argoCrConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.finalizeRevoked(ctx, argoCrConfig)
+	}
+	if blocked, result, err := r.reconcileRevocation(ctx, argoCrConfig); blocked || err != nil {
+		return result, err
+	}
+
+	// a suspended config is frozen, neither rotation nor cleanup happens
+	suspended.set(key, argoCrConfig.Spec.Suspend, suspendedConfigs)
+	if argoCrConfig.Spec.Suspend {
+		if !argoCrConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+			reqLogger.Info("Config is suspended, deletion waits until it is resumed")
+		}
+		if setSuspendedCondition(argoCrConfig) {
+			if err := r.updateConfigStatus(ctx, argoCrConfig); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+	setSuspendedCondition(argoCrConfig)
+
+	// a deleting config only gets its outputs removed, never new credentials
+	if !argoCrConfig.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, argoCrConfig)
+	}
+	// register the finalizer before any output exists
+	if controllerutil.AddFinalizer(argoCrConfig, configFinalizer) {
+		if err := r.updateConfig(ctx, argoCrConfig); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if wait := retryPending(argoCrConfig, time.Now()); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+	// the vault section was removed, its secret goes with it
+	if argoCrConfig.Spec.Vault == nil && argoCrConfig.Status.Vault != nil {
+		if err := r.deleteVault(ctx, argoCrConfig); err != nil {
+			reqLogger.Error(err, "Unable to delete the Vault secret")
+			return ctrl.Result{}, err
+		}
+	}
 
 	referenceSecret := &v1.Secret{}
 
@@ -71,125 +153,456 @@ func (r *ConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	// Generate a new secret
 	// Logic: if client.get produce error no secret is present
 	// if the error is "not found" create a secret
-	if err = r.Client.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: argoCrConfig.Spec.Shoot}, referenceSecret); err != nil {
-		if errors.IsNotFound(err) {
+	// with Vault or a remote ArgoCD as only output there is no secret, the status tells if credentials were issued
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: argoCrConfig.Namespace, Name: gardener.SecretName(argoCrConfig)}, referenceSecret)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
 
-			// Generate new Secret with Token
-			newSecret, newApi, err := gardener.GenerateSecret(&gardener.Input{
-				S: argoCrConfig,
-			})
-			if err != nil {
-				reqLogger.Error(err, "Unable to generate secret")
-				return ctrl.Result{}, err
-			}
-			// export api rul
-			apiUrl = newApi
+	// never touch a secret somebody else created unless it is explicitly handed over
+	conflict := err == nil && !skipSecret(argoCrConfig) && !ownsSecret(argoCrConfig, referenceSecret)
+	if err == nil && !conflict && legacySecret(argoCrConfig, referenceSecret) {
+		reqLogger.Info(fmt.Sprintf("Migrate secret %s/%s of an operator version before the managed-by label", argoCrConfig.Namespace, referenceSecret.Name))
+	} else if err == nil && !conflict && !secretManaged(argoCrConfig, referenceSecret) {
+		reqLogger.Info(fmt.Sprintf("Adopt secret %s/%s", argoCrConfig.Namespace, referenceSecret.Name))
+	}
+	if setConflictCondition(argoCrConfig, referenceSecret, conflict) && conflict {
+		reqLogger.Info(fmt.Sprintf("Secret %s/%s is not managed by the operator for this config", argoCrConfig.Namespace, referenceSecret.Name))
+		if err := r.updateConfigStatus(ctx, argoCrConfig); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if conflict {
+		return ctrl.Result{RequeueAfter: argoCrConfig.Spec.Frequency.Duration}, nil
+	}
+	if err == nil && !skipSecret(argoCrConfig) {
+		if err := r.claimSecret(ctx, argoCrConfig, referenceSecret); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if errors.IsNotFound(err) && !(skipSecret(argoCrConfig) && argoCrConfig.Status.LastUpdatedTime != nil) {
+		shootInfo, err := gardener.GetInfo(ctx, argoCrConfig.Spec.Project, argoCrConfig.Spec.Shoot)
+		if err != nil {
+			reqLogger.Error(err, "Unable to get shoot info")
+			return ctrl.Result{}, err
+		}
+
+		shard, err := r.assignShard(ctx, argoCrConfig, nil)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Generate new Secret with Token
+		newSecret, newApi, err := gardener.GenerateSecret(ctx, &gardener.Input{
+			S:            argoCrConfig,
+			Info:         shootInfo,
+			Shard:        shard,
+			Stages:       settings.StageMapping,
+			SafetyMargin: settings.Rotation.SafetyMargin.Duration,
+		})
+		if err != nil {
+			reqLogger.Error(err, "Unable to generate secret")
+			return r.rotationFailed(ctx, argoCrConfig, err, settings)
+		}
+		// export api rul
+		apiUrl = newApi
 
-			message = fmt.Sprintf("Generate new remote Cluster secret %s/%s", req.Namespace, argoCrConfig.Spec.Shoot)
+		gardener.RecordManagedKeys(newSecret, newSecret.Labels, newSecret.Annotations)
+		hash, err := gardener.ContentHash(newSecret)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		newSecret.Annotations[gardener.ContentHashAnnotation] = hash
+
+		if !skipSecret(argoCrConfig) {
+			message = fmt.Sprintf("Generate new remote Cluster secret %s/%s", argoCrConfig.Namespace, newSecret.Name)
 			reqLogger.Info(message)
 			if err = r.Client.Create(ctx, newSecret); err != nil {
 				reqLogger.Info("Unable to Create secret - try reconciling")
 				return ctrl.Result{}, err
 			}
+		}
+		if argoCrConfig.Spec.Vault != nil {
+			reqLogger.Info("Write credentials to Vault")
+			if err = r.writeVault(ctx, argoCrConfig, newSecret); err != nil {
+				reqLogger.Error(err, "Unable to write credentials to Vault")
+				return ctrl.Result{}, err
+			}
+		}
+		if remoteArgoCD(argoCrConfig) {
+			reqLogger.Info("Register cluster at remote ArgoCD")
+			if err = r.registerRemote(ctx, argoCrConfig, newSecret); err != nil {
+				reqLogger.Error(err, "Unable to register cluster at remote ArgoCD")
+				return ctrl.Result{}, err
+			}
+		}
 
-			changed = true
-			argoCrConfig.Status.Phase = "Created"
-			argoCrConfig.Status.LastUpdatedTime = &metav1.Time{Time: time.Now()}
-		} else {
+		r.auditIssue(ctx, argoCrConfig, newSecret, auditReasonCreated)
+
+		r.rotationSucceeded(argoCrConfig)
+		changed = true
+		argoCrConfig.Status.Phase = "Created"
+		argoCrConfig.Status.LastUpdatedTime = &metav1.Time{Time: time.Now()}
+		argoCrConfig.Status.CARotationPhase = shootInfo.CARotationPhase
+		argoCrConfig.Status.Shard = shard
+		argoCrConfig.Status.Shoot = shootInfo.ShootStatus(settings.StageMapping)
+	} else {
+		shootInfo, err := gardener.GetInfo(ctx, argoCrConfig.Spec.Project, argoCrConfig.Spec.Shoot)
+		if err != nil {
+			reqLogger.Error(err, "Unable to get shoot info")
 			return ctrl.Result{}, err
 		}
-	} else {
-		// update the secret, add 1 Minutes to make sure token is never deprecated
-		// and prevent redundant runs
+
+		shard, err := r.assignShard(ctx, argoCrConfig, referenceSecret)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// update the secret once the frequency is over, subtract the skew to make sure token
+		// is never deprecated and prevent redundant runs in between
 		timeNow := &metav1.Time{Time: time.Now()}
-		lastUpdateTime := argoCrConfig.Status.LastUpdatedTime.Add(time.Duration(+1) * time.Minute)
-		if timeNow.After(lastUpdateTime) {
-			message = fmt.Sprintf("Update config %s/%s", req.Namespace, argoCrConfig.Spec.Shoot)
+		lastIssued := time.Time{}
+		if argoCrConfig.Status.LastUpdatedTime != nil {
+			lastIssued = argoCrConfig.Status.LastUpdatedTime.Time
+		}
+		// the secret knows its issuance even if the last status update got lost
+		if issuedAt, ok := gardener.IssuedAt(referenceSecret); ok && issuedAt.After(lastIssued) {
+			lastIssued = issuedAt
+		}
+		lastUpdateTime := rotationDue(argoCrConfig, lastIssued, settings)
+		// every phase change of a CA rotation needs new credentials signed by the valid CA
+		caRotationChanged := shootInfo.CARotationPhase != argoCrConfig.Status.CARotationPhase
+		// the exec or AWS authentication was removed, ArgoCD needs a client certificate now
+		authChanged := argoCrConfig.Spec.DesiredOutput == "ArgoCD" && !skipSecret(argoCrConfig) &&
+			gardener.ClientCertificateMissing(argoCrConfig, referenceSecret)
+		if timeNow.After(lastUpdateTime) || caRotationChanged || authChanged {
+			message = fmt.Sprintf("Update config %s/%s", argoCrConfig.Namespace, argoCrConfig.Spec.Shoot)
+			if caRotationChanged {
+				message = fmt.Sprintf("%s, CA rotation phase changed to %q", message, shootInfo.CARotationPhase)
+			}
+			if authChanged {
+				message = fmt.Sprintf("%s, the cluster secret has no client certificate", message)
+			}
 			reqLogger.Info(message)
 
 			// Generate new Secret with Token
-			newSecret, _, err := gardener.GenerateSecret(&gardener.Input{
-				S: argoCrConfig,
+			newSecret, _, err := gardener.GenerateSecret(ctx, &gardener.Input{
+				S:            argoCrConfig,
+				Info:         shootInfo,
+				Shard:        shard,
+				Stages:       settings.StageMapping,
+				SafetyMargin: settings.Rotation.SafetyMargin.Duration,
 			})
 			if err != nil {
 				reqLogger.Error(err, "Unable to refresh secret")
-				return ctrl.Result{}, err
+				return r.rotationFailed(ctx, argoCrConfig, err, settings)
 			}
 
-			referenceSecret.Data = newSecret.Data
-			if err = r.Client.Update(ctx, referenceSecret); err != nil {
-				return ctrl.Result{}, err
+			if !skipSecret(argoCrConfig) {
+				if _, err = r.patchSecret(ctx, referenceSecret, newSecret, true); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			if argoCrConfig.Spec.Vault != nil {
+				if err = r.writeVault(ctx, argoCrConfig, newSecret); err != nil {
+					reqLogger.Error(err, "Unable to write credentials to Vault")
+					return ctrl.Result{}, err
+				}
 			}
+			if remoteArgoCD(argoCrConfig) {
+				if err = r.registerRemote(ctx, argoCrConfig, newSecret); err != nil {
+					reqLogger.Error(err, "Unable to register cluster at remote ArgoCD")
+					return ctrl.Result{}, err
+				}
+			}
+			reason := auditReasonRotation
+			if caRotationChanged {
+				reason = auditReasonCARotation
+			}
+			r.auditIssue(ctx, argoCrConfig, newSecret, reason)
+
+			r.rotationSucceeded(argoCrConfig)
 			changed = true
 			argoCrConfig.Status.Phase = "Updated"
 			argoCrConfig.Status.LastUpdatedTime = &metav1.Time{Time: time.Now()}
+			argoCrConfig.Status.CARotationPhase = shootInfo.CARotationPhase
+			argoCrConfig.Status.Shard = shard
+		} else if !skipSecret(argoCrConfig) {
+			// no rotation due, only keep labels, annotations and the non-credential data in sync with the config
+			input := &gardener.Input{S: argoCrConfig, Info: shootInfo, Shard: shard, Stages: settings.StageMapping}
+			desired := referenceSecret.DeepCopy()
+			desired.Labels, err = gardener.GenerateLabels(ctx, input, shootInfo)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			desired.Annotations, err = gardener.GenerateAnnotations(ctx, input, shootInfo)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if argoCrConfig.Spec.DesiredOutput == "ArgoCD" {
+				desired.Data, err = gardener.RefreshArgoCDClusterData(input, referenceSecret)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			patched, err := r.patchSecret(ctx, referenceSecret, desired, false)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if patched {
+				reqLogger.Info(fmt.Sprintf("Updated metadata of secret %s/%s", argoCrConfig.Namespace, referenceSecret.Name))
+			}
+			argoCrConfig.Status.Shard = shard
 		}
+		// also between rotations, the maintenance window of the shoot feeds the project
+		argoCrConfig.Status.Shoot = shootInfo.ShootStatus(settings.StageMapping)
 	}
 
-	if apiUrl != "" && argoCrConfig.Spec.DesiredOutput == "ArgoCD" {
-		reqLogger.Info("Create Project")
-		err := argocd.CreateProject(&argocd.Input{S: argoCrConfig}, apiUrl)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-		argoCrConfig.Status.ProjectName = strings.Split(argoCrConfig.Spec.Shoot, "-")[1][0:3]
+	server := apiUrl
+	if server == "" {
+		server = shootServer(argoCrConfig, string(referenceSecret.Data["server"]))
+	}
+	// also records the project of a secret adopted from an orphaned config
+	if err := r.reconcileProject(ctx, argoCrConfig, server); err != nil {
+		reqLogger.Error(err, "Unable to reconcile ArgoCD Project")
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileBootstrap(ctx, argoCrConfig, server); err != nil {
+		reqLogger.Error(err, "Unable to bootstrap the shoot")
+		return ctrl.Result{}, err
 	}
 
-	if err := r.Client.Status().Update(ctx, argoCrConfig); err != nil {
+	if err := r.updateConfigStatus(ctx, argoCrConfig); err != nil {
 		reqLogger.Info("Unable to update remote Cluster secret status - try reconciling")
 		return ctrl.Result{}, err
 	}
 
-	// Finalizer
-	finalizerName := []string{"configs.customer.gardener/finalizer"}
-
-	// examine DeletionTimestamp to determine if object is under deletion
-	if argoCrConfig.ObjectMeta.DeletionTimestamp.IsZero() {
-		// The object is not being deleted, so if it does not have our finalizer,
-		// then lets add the finalizer and update the object. This is equivalent
-		// registering our finalizer.
-		if argoCrConfig.ObjectMeta.Finalizers == nil {
-			argoCrConfig.ObjectMeta.Finalizers = finalizerName
-			if err := r.Client.Update(ctx, argoCrConfig); err != nil {
-				return ctrl.Result{}, err
-			}
+	requeueAfter := argoCrConfig.Spec.Frequency.Duration
+	if argoCrConfig.Status.LastUpdatedTime != nil {
+		requeueAfter = time.Until(rotationDue(argoCrConfig, argoCrConfig.Status.LastUpdatedTime.Time, settings))
+		if requeueAfter < minRequeue {
+			requeueAfter = minRequeue
 		}
 	}
-	if !argoCrConfig.ObjectMeta.DeletionTimestamp.IsZero() {
-		// The object is being deleted
-		// our finalizer is present, so lets handle any external dependency
-		err := r.Client.Delete(ctx, referenceSecret)
-		if err != nil && !errors.IsNotFound(err) {
-			// if it fail because an other reason then not present to delete the external
-			// dependency here, return with error so that it can be retried
-			return ctrl.Result{}, err
-		}
-		if argoCrConfig.Status.ProjectName != "" {
-			argocd.DeleteProject(req.Namespace, argoCrConfig.Status.ProjectName)
-			reqLogger.Info("ArgoCD Project Deleted")
-		}
-
-		// remove finalizer from the list and update it.
-		argoCrConfig.ObjectMeta.Finalizers = []string{}
-		if err := r.Client.Update(ctx, argoCrConfig); err != nil {
-			return ctrl.Result{}, err
-		}
-		// return with no errors
-		reqLogger.Info("CR Deleted")
-		return ctrl.Result{}, nil
+	// follow the phases of a running CA rotation closer than the token frequency
+	if gardener.CARotationInProgress(argoCrConfig.Status.CARotationPhase) && requeueAfter > caRotationRequeue {
+		requeueAfter = caRotationRequeue
 	}
 
 	if changed {
-		message = fmt.Sprintf("RequeueAfter: %s", argoCrConfig.Spec.Frequency.Duration)
+		message = fmt.Sprintf("RequeueAfter: %s", requeueAfter)
 		reqLogger.Info(message)
 	}
-	// substract 1 minute to prevent depreaction gap
-	return ctrl.Result{RequeueAfter: (argoCrConfig.Spec.Frequency.Duration)}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&customergardenerv1.Config{}).
-		Complete(r)
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Operator.Get().Controller.MaxConcurrentReconciles})
+	if r.Resync != nil {
+		b = b.Watches(&source.Channel{Source: r.Resync}, handler.EnqueueRequestsFromMapFunc(r.allConfigs))
+	}
+	return b.Complete(r)
+}
+
+// allConfigs returns a request for every Config, used on a resync
+func (r *ConfigReconciler) allConfigs(client.Object) []reconcile.Request {
+	configs := &customergardenerv1.ConfigList{}
+	if err := r.Client.List(context.Background(), configs); err != nil {
+		log.Log.Error(err, "Unable to list Configs for a resync")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(configs.Items))
+	for i := range configs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&configs.Items[i])})
+	}
+	return requests
+}
+
+// rotationDue returns when the credentials issued at lastIssued have to be rotated: the skew
+// and the jitter share of the config before the frequency is over
+func rotationDue(config *customergardenerv1.Config, lastIssued time.Time, settings *operatorconfig.OperatorConfiguration) time.Time {
+	frequency := config.Spec.Frequency.Duration
+	return lastIssued.Add(frequency - settings.Rotation.Skew.Duration - rotationJitter(config, frequency, *settings.Rotation.Jitter))
+}
+
+// rotationJitter returns a share of the frequency up to jitter, derived from the UID so it is
+// stable for a config and spread over all configs
+func rotationJitter(config *customergardenerv1.Config, frequency time.Duration, jitter float64) time.Duration {
+	h := fnv.New32a()
+	h.Write([]byte(config.UID))
+	return time.Duration(float64(frequency) * jitter * float64(h.Sum32()) / math.MaxUint32)
+}
+
+// patchSecret brings the secret in line with the desired one, labels and annotations are
+// merged so foreign ones survive, the ones the operator set before and which are no longer
+// desired are removed. Without new credentials the patch is skipped as long as the content
+// hash did not change.
+func (r *ConfigReconciler) patchSecret(ctx context.Context, current *v1.Secret, desired *v1.Secret, rotate bool) (bool, error) {
+	merged := current.DeepCopy()
+	for _, k := range gardener.ManagedKeys(current, gardener.ManagedLabelsAnnotation) {
+		if _, ok := desired.Labels[k]; !ok {
+			delete(merged.Labels, k)
+		}
+	}
+	for _, k := range gardener.ManagedKeys(current, gardener.ManagedAnnotationsAnnotation) {
+		if _, ok := desired.Annotations[k]; !ok {
+			delete(merged.Annotations, k)
+		}
+	}
+	if merged.Labels == nil {
+		merged.Labels = map[string]string{}
+	}
+	for k, v := range desired.Labels {
+		merged.Labels[k] = v
+	}
+	if merged.Annotations == nil {
+		merged.Annotations = map[string]string{}
+	}
+	for k, v := range desired.Annotations {
+		merged.Annotations[k] = v
+	}
+	merged.Data = desired.Data
+	gardener.RecordManagedKeys(merged, desired.Labels, desired.Annotations)
+
+	hash, err := gardener.ContentHash(merged)
+	if err != nil {
+		return false, err
+	}
+	if !rotate && current.Annotations[gardener.ContentHashAnnotation] == hash {
+		return false, nil
+	}
+	merged.Annotations[gardener.ContentHashAnnotation] = hash
+
+	if err := r.Client.Patch(ctx, merged, client.MergeFrom(current)); err != nil {
+		return false, err
+	}
+	merged.DeepCopyInto(current)
+	return true, nil
+}
+
+// assignShard returns the ArgoCD application controller shard for the cluster secret of the
+// config, a shard set in the config always wins over the operator assignment
+func (r *ConfigReconciler) assignShard(ctx context.Context, config *customergardenerv1.Config, current *v1.Secret) (*int64, error) {
+	if config.Spec.DesiredOutput != "ArgoCD" {
+		return nil, nil
+	}
+	if config.Spec.ArgoCD != nil && config.Spec.ArgoCD.Shard != nil {
+		return config.Spec.ArgoCD.Shard, nil
+	}
+	sharding := r.Operator.Get().Sharding
+	if !sharding.Enabled() {
+		return nil, nil
+	}
+
+	var shard int64
+	switch sharding.Strategy {
+	case argocd.ShardingLeastLoaded:
+		secrets := &v1.SecretList{}
+		if err := r.Client.List(ctx, secrets,
+			client.InNamespace(config.Namespace),
+			client.MatchingLabels{"argocd.argoproj.io/secret-type": "cluster"}); err != nil {
+			return nil, err
+		}
+		var currentShard *int64
+		if current != nil {
+			currentShard = gardener.SecretShard(current)
+		}
+		secret := types.NamespacedName{Namespace: config.Namespace, Name: gardener.SecretName(config)}
+		shard = reservedShards.assign(secret, secrets.Items, sharding.Shards, time.Now(), func(loads []int) int64 {
+			return argocd.LeastLoadedShard(loads, currentShard)
+		})
+	default:
+		shard = argocd.HashShard(config.Spec.Shoot, sharding.Shards)
+	}
+	return &shard, nil
+}
+
+// skipSecret reports whether no Kubernetes secret is written, the credentials only go to
+// Vault or a remote ArgoCD
+func skipSecret(config *customergardenerv1.Config) bool {
+	return (config.Spec.Vault != nil && config.Spec.Vault.SkipSecret) || remoteArgoCD(config)
+}
+
+// ownsSecret reports whether the operator may change or delete the secret for the config,
+// a secret of another config is never taken over, not even with the adopt annotation
+func ownsSecret(config *customergardenerv1.Config, secret *v1.Secret) bool {
+	if foreignOwner(config, secret) != "" {
+		return false
+	}
+	return secretManaged(config, secret) || legacySecret(config, secret) ||
+		secret.Annotations[customergardenerv1.AdoptAnnotation] == "true"
+}
+
+// foreignOwner returns the other config the secret belongs to, empty if it is unowned or owned by the config
+func foreignOwner(config *customergardenerv1.Config, secret *v1.Secret) string {
+	if owner := secret.Annotations[customergardenerv1.OwnerAnnotation]; owner != "" && owner != config.Name {
+		return owner
+	}
+	return ""
+}
+
+// secretManaged reports whether the secret was created by the operator for the config. Managed
+// secrets without an owner, written before the owner annotation or orphaned by a deleted config,
+// are claimed by the first config reconciling them.
+func secretManaged(config *customergardenerv1.Config, secret *v1.Secret) bool {
+	if secret.Labels[customergardenerv1.ManagedByLabel] == customergardenerv1.ManagedByValue && foreignOwner(config, secret) == "" {
+		return true
+	}
+	for _, owner := range secret.OwnerReferences {
+		if owner.UID == config.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// claimSecret records the config as owner of the secret, the content hash ignores the operator
+// annotations, so secrets written before the owner annotation would not get it otherwise
+func (r *ConfigReconciler) claimSecret(ctx context.Context, config *customergardenerv1.Config, secret *v1.Secret) error {
+	if secret.Annotations[customergardenerv1.OwnerAnnotation] == config.Name {
+		return nil
+	}
+	current := secret.DeepCopy()
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[customergardenerv1.OwnerAnnotation] = config.Name
+	return r.Client.Patch(ctx, secret, client.MergeFrom(current))
+}
+
+// labels and data keys of the cluster secrets written before the managed-by label
+var (
+	legacySecretLabels = []string{"argocd.argoproj.io/secret-type", "clustername", "stage", "cloudprovider"}
+	legacySecretKeys   = []string{"name", "server", "config"}
+)
+
+// legacySecret reports whether the secret is the cluster secret an operator version before the
+// managed-by label wrote for the config. It has to match that version exactly, its labels, its
+// data keys and its name, and the config has to have issued credentials before. The next write
+// labels the secret, so the migration happens once.
+func legacySecret(config *customergardenerv1.Config, secret *v1.Secret) bool {
+	if config.Spec.DesiredOutput != "ArgoCD" || config.Status.LastUpdatedTime == nil {
+		return false
+	}
+	if _, ok := secret.Labels[customergardenerv1.ManagedByLabel]; ok || len(secret.OwnerReferences) > 0 {
+		return false
+	}
+	if secret.Name != config.Spec.Shoot || len(secret.Labels) != len(legacySecretLabels) || len(secret.Data) != len(legacySecretKeys) {
+		return false
+	}
+	for _, label := range legacySecretLabels {
+		if _, ok := secret.Labels[label]; !ok {
+			return false
+		}
+	}
+	for _, key := range legacySecretKeys {
+		if _, ok := secret.Data[key]; !ok {
+			return false
+		}
+	}
+	return secret.Labels["argocd.argoproj.io/secret-type"] == "cluster" &&
+		secret.Labels["clustername"] == config.Spec.Shoot && string(secret.Data["name"]) == config.Spec.Shoot
 }
@@ -0,0 +1,136 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/operatorconfig"
+)
+
+var _ = Describe("Secret ownership", func() {
+	issued := metav1.NewTime(time.Now())
+	config := &customergardenerv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc-dev", Namespace: "argocd", UID: "config-uid"},
+		Spec:       customergardenerv1.ConfigSpec{DesiredOutput: "ArgoCD", Project: "abc", Shoot: "abc-dev"},
+		Status:     customergardenerv1.ConfigStatus{LastUpdatedTime: &issued},
+	}
+	// legacy is a secret like operator versions before the managed-by label wrote it
+	legacy := func() *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "abc-dev", Namespace: "argocd", Labels: map[string]string{
+				"argocd.argoproj.io/secret-type": "cluster",
+				"clustername":                    "abc-dev",
+				"stage":                          "dev",
+				"cloudprovider":                  "aws",
+			}},
+			Data: map[string][]byte{
+				"name":   []byte("abc-dev"),
+				"server": []byte("https://api.abc-dev.example.com"),
+				"config": []byte("{}"),
+			},
+		}
+	}
+
+	It("migrates a secret of an operator version before the managed-by label", func() {
+		Expect(ownsSecret(config, legacy())).To(BeTrue())
+	})
+
+	It("does not take over a cluster secret which only looks similar", func() {
+		secret := legacy()
+		secret.Labels["team"] = "platform"
+		Expect(ownsSecret(config, secret)).To(BeFalse())
+
+		secret = legacy()
+		secret.Data["namespaces"] = []byte("app")
+		Expect(ownsSecret(config, secret)).To(BeFalse())
+
+		secret = legacy()
+		secret.Labels[customergardenerv1.ManagedByLabel] = "helm"
+		Expect(ownsSecret(config, secret)).To(BeFalse())
+
+		// a new config never issued the secret
+		fresh := config.DeepCopy()
+		fresh.Status.LastUpdatedTime = nil
+		Expect(ownsSecret(fresh, legacy())).To(BeFalse())
+	})
+
+	It("adopts any secret with the adopt annotation", func() {
+		secret := legacy()
+		secret.Labels["team"] = "platform"
+		secret.Annotations = map[string]string{customergardenerv1.AdoptAnnotation: "true"}
+		Expect(ownsSecret(config, secret)).To(BeTrue())
+	})
+
+	It("does not take over the secret of another config of the same shoot", func() {
+		managed := func(owner string) *v1.Secret {
+			secret := legacy()
+			secret.Labels[customergardenerv1.ManagedByLabel] = customergardenerv1.ManagedByValue
+			if owner != "" {
+				secret.Annotations = map[string]string{customergardenerv1.OwnerAnnotation: owner}
+			}
+			return secret
+		}
+		Expect(ownsSecret(config, managed("abc-dev"))).To(BeTrue())
+		// written before the owner annotation or orphaned, claimed by the first config
+		Expect(ownsSecret(config, managed(""))).To(BeTrue())
+
+		other := managed("abc-dev-second")
+		Expect(ownsSecret(config, other)).To(BeFalse())
+		other.Annotations[customergardenerv1.AdoptAnnotation] = "true"
+		Expect(ownsSecret(config, other)).To(BeFalse())
+
+		reported := config.DeepCopy()
+		Expect(setConflictCondition(reported, other, true)).To(BeTrue())
+		condition := meta.FindStatusCondition(reported.Status.Conditions, customergardenerv1.ConditionConflict)
+		Expect(condition.Reason).To(Equal("SecretOwnedByOtherConfig"))
+		Expect(condition.Message).To(ContainSubstring("abc-dev-second"))
+	})
+})
+
+var _ = Describe("Rotation due", func() {
+	issued := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	config := &customergardenerv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc-dev", Namespace: "argocd", UID: "config-uid"},
+		Spec:       customergardenerv1.ConfigSpec{Frequency: &metav1.Duration{Duration: time.Hour}},
+	}
+
+	It("rotates the skew before the frequency is over", func() {
+		settings := operatorconfig.DefaultConfiguration()
+		jitter := 0.0
+		settings.Rotation.Jitter = &jitter
+		Expect(rotationDue(config, issued, settings)).To(Equal(issued.Add(59 * time.Minute)))
+	})
+
+	It("does not rotate on the requeues of a CA rotation or other reconciles in between", func() {
+		settings := operatorconfig.DefaultConfiguration()
+		due := rotationDue(config, issued, settings)
+		Expect(due).To(BeTemporally(">", issued.Add(caRotationRequeue)))
+		// the jitter brings the rotation forward by at most its share of the frequency
+		Expect(due).To(BeTemporally(">=", issued.Add(53*time.Minute)))
+		Expect(due).To(BeTemporally("<=", issued.Add(59*time.Minute)))
+		Expect(rotationDue(config, issued, settings)).To(Equal(due))
+	})
+})
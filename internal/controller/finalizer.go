@@ -0,0 +1,183 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/gardener"
+)
+
+// finalizer of the operator, other finalizers of a config are left alone
+const configFinalizer = "configs.customer.gardener/finalizer"
+
+// cleanupDone reports whether a cleanup step does not need to run again
+func cleanupDone(state string) bool {
+	return state == customergardenerv1.CleanupDeleted || state == customergardenerv1.CleanupKept
+}
+
+// finalize removes the outputs of a deleted config as far as the deletion policy allows it.
+// Every output is tracked in the cleanup status, failed steps are retried and the finalizer
+// is only removed once nothing failed. No credentials are issued here.
+func (r *ConfigReconciler) finalize(ctx context.Context, config *customergardenerv1.Config) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(config, configFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	policy := config.Spec.DeletionPolicy
+	if config.Status.Cleanup == nil {
+		config.Status.Cleanup = &customergardenerv1.CleanupStatus{}
+	}
+	cleanup := config.Status.Cleanup
+	cleanup.LastError = ""
+	config.Status.Phase = "Deleting"
+
+	var failed error
+	fail := func(output string, err error) string {
+		reqLogger.Error(err, fmt.Sprintf("Unable to delete %s", output))
+		failed = err
+		cleanup.LastError = fmt.Sprintf("%s: %s", output, err)
+		return customergardenerv1.CleanupFailed
+	}
+
+	if !cleanupDone(cleanup.Secret) && !skipSecret(config) {
+		cleanup.Secret = customergardenerv1.CleanupKept
+		if policy != customergardenerv1.DeletionPolicyOrphan {
+			if err := r.deleteSecret(ctx, config); err != nil {
+				cleanup.Secret = fail("secret", err)
+			} else {
+				cleanup.Secret = customergardenerv1.CleanupDeleted
+			}
+		} else if err := r.releaseSecret(ctx, config); err != nil {
+			cleanup.Secret = fail("secret owner", err)
+		}
+	}
+
+	if !cleanupDone(cleanup.Vault) && config.Status.Vault != nil {
+		cleanup.Vault = customergardenerv1.CleanupKept
+		if policy != customergardenerv1.DeletionPolicyOrphan {
+			if err := r.deleteVault(ctx, config); err != nil {
+				cleanup.Vault = fail("vault secret", err)
+			} else {
+				cleanup.Vault = customergardenerv1.CleanupDeleted
+			}
+		}
+	}
+
+	// the Application goes before the remote cluster and the project it points to
+	if !cleanupDone(cleanup.Bootstrap) && config.Status.Bootstrap != nil {
+		cleanup.Bootstrap = customergardenerv1.CleanupKept
+		if policy != customergardenerv1.DeletionPolicyOrphan {
+			if err := r.deleteBootstrap(ctx, config); err != nil {
+				cleanup.Bootstrap = fail("bootstrap Application", err)
+			} else {
+				cleanup.Bootstrap = customergardenerv1.CleanupDeleted
+			}
+		}
+	}
+
+	if !cleanupDone(cleanup.Remote) && config.Status.Remote != nil {
+		cleanup.Remote = customergardenerv1.CleanupKept
+		if policy != customergardenerv1.DeletionPolicyOrphan {
+			if err := r.deleteRemote(ctx, config); err != nil {
+				cleanup.Remote = fail("remote ArgoCD cluster", err)
+			} else {
+				cleanup.Remote = customergardenerv1.CleanupDeleted
+			}
+		}
+	}
+
+	if !cleanupDone(cleanup.Project) && config.Status.ProjectName != "" {
+		cleanup.Project = customergardenerv1.CleanupKept
+		if policy == "" || policy == customergardenerv1.DeletionPolicyDelete {
+			if err := r.deleteProject(ctx, config); err != nil {
+				cleanup.Project = fail("ArgoCD Project", err)
+			} else {
+				cleanup.Project = customergardenerv1.CleanupDeleted
+				reqLogger.Info("ArgoCD Project Deleted")
+			}
+		}
+	}
+
+	if err := r.updateConfigStatus(ctx, config); err != nil {
+		return ctrl.Result{}, err
+	}
+	if failed != nil {
+		// retried with the backoff of the controller
+		return ctrl.Result{}, failed
+	}
+
+	if cleanup.Secret == customergardenerv1.CleanupDeleted || cleanup.Vault == customergardenerv1.CleanupDeleted ||
+		cleanup.Remote == customergardenerv1.CleanupDeleted {
+		r.auditDelete(ctx, config, "config deleted")
+	} else {
+		reqLogger.Info("Deletion policy Orphan, keep secret and ArgoCD Project")
+	}
+
+	controllerutil.RemoveFinalizer(config, configFinalizer)
+	if err := r.updateConfig(ctx, config); err != nil {
+		return ctrl.Result{}, err
+	}
+	reqLogger.Info("CR Deleted")
+	return ctrl.Result{}, nil
+}
+
+// deleteSecret removes the secret of the config unless it belongs to somebody else
+func (r *ConfigReconciler) deleteSecret(ctx context.Context, config *customergardenerv1.Config) error {
+	secret := &v1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: config.Namespace, Name: gardener.SecretName(config)}, secret)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ownsSecret(config, secret) {
+		log.FromContext(ctx).Info(fmt.Sprintf("Keep secret %s/%s, it is not managed by the operator", secret.Namespace, secret.Name))
+		return nil
+	}
+	return client.IgnoreNotFound(r.Client.Delete(ctx, secret))
+}
+
+// releaseSecret removes the owner of an orphaned secret, so a new config of the shoot can adopt it
+func (r *ConfigReconciler) releaseSecret(ctx context.Context, config *customergardenerv1.Config) error {
+	secret := &v1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: config.Namespace, Name: gardener.SecretName(config)}, secret)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if secret.Annotations[customergardenerv1.OwnerAnnotation] != config.Name {
+		return nil
+	}
+	current := secret.DeepCopy()
+	delete(secret.Annotations, customergardenerv1.OwnerAnnotation)
+	return client.IgnoreNotFound(r.Client.Patch(ctx, secret, client.MergeFrom(current)))
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/argocd"
+	"customer.gardener/config/pkg/operatorconfig"
+)
+
+var _ = Describe("Finalizer", func() {
+	ctx := context.Background()
+	const otherFinalizer = "example.com/keep"
+
+	// deletedConfig creates a config with its secret and AppProject and deletes it, another
+	// finalizer keeps the config around after the operator is done
+	deletedConfig := func(name string, policy string) (*customergardenerv1.Config, *v1.Secret, *unstructured.Unstructured) {
+		requireEnvtest()
+		config := &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       name,
+				Namespace:  "default",
+				Finalizers: []string{configFinalizer, otherFinalizer},
+			},
+			Spec: customergardenerv1.ConfigSpec{DesiredOutput: "Plain", Project: "abc", Shoot: name, DeletionPolicy: policy},
+		}
+		Expect(k8sClient.Create(ctx, config)).To(Succeed())
+		config.Status.ProjectName = name
+		Expect(k8sClient.Status().Update(ctx, config)).To(Succeed())
+
+		secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:        name + "-plain",
+			Namespace:   "default",
+			Labels:      map[string]string{customergardenerv1.ManagedByLabel: customergardenerv1.ManagedByValue},
+			Annotations: map[string]string{customergardenerv1.OwnerAnnotation: name},
+		}}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		project := &unstructured.Unstructured{}
+		project.SetGroupVersionKind(argocd.AppProjectGVK)
+		project.SetNamespace("default")
+		project.SetName(name)
+		project.SetLabels(map[string]string{customergardenerv1.ManagedByLabel: customergardenerv1.ManagedByValue})
+		Expect(k8sClient.Create(ctx, project)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, config)).To(Succeed())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(config), config)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, secret))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, project))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(config), config))).To(Succeed())
+			config.Finalizers = nil
+			Expect(client.IgnoreNotFound(k8sClient.Update(ctx, config))).To(Succeed())
+		})
+		return config, secret, project
+	}
+	exists := func(object client.Object) bool {
+		err := k8sClient.Get(ctx, client.ObjectKeyFromObject(object), object)
+		Expect(client.IgnoreNotFound(err)).To(Succeed())
+		return !errors.IsNotFound(err)
+	}
+
+	It("deletes the secret and the project and removes only its own finalizer", func() {
+		config, secret, project := deletedConfig("finalize-delete", customergardenerv1.DeletionPolicyDelete)
+
+		_, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists(secret)).To(BeFalse())
+		Expect(exists(project)).To(BeFalse())
+		Expect(config.Finalizers).To(ConsistOf(otherFinalizer))
+		Expect(config.Status.Cleanup.Secret).To(Equal(customergardenerv1.CleanupDeleted))
+		Expect(config.Status.Cleanup.Project).To(Equal(customergardenerv1.CleanupDeleted))
+		Expect(config.Status.Cleanup.LastError).To(BeEmpty())
+	})
+
+	It("keeps everything with the Orphan policy", func() {
+		config, secret, project := deletedConfig("finalize-orphan", customergardenerv1.DeletionPolicyOrphan)
+
+		_, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists(secret)).To(BeTrue())
+		// released, so a new config of the shoot can adopt it
+		Expect(secret.Annotations).NotTo(HaveKey(customergardenerv1.OwnerAnnotation))
+		Expect(exists(project)).To(BeTrue())
+		Expect(config.Finalizers).To(ConsistOf(otherFinalizer))
+		Expect(config.Status.Cleanup.Secret).To(Equal(customergardenerv1.CleanupKept))
+		Expect(config.Status.Cleanup.Project).To(Equal(customergardenerv1.CleanupKept))
+	})
+
+	It("deletes the secret but keeps the project with the DeleteSecretKeepProject policy", func() {
+		config, secret, project := deletedConfig("finalize-keep-project", customergardenerv1.DeletionPolicyDeleteSecretKeepProject)
+
+		_, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists(secret)).To(BeFalse())
+		Expect(exists(project)).To(BeTrue())
+		Expect(config.Finalizers).To(ConsistOf(otherFinalizer))
+		Expect(config.Status.Cleanup.Secret).To(Equal(customergardenerv1.CleanupDeleted))
+		Expect(config.Status.Cleanup.Project).To(Equal(customergardenerv1.CleanupKept))
+	})
+
+	It("does not repeat a finished cleanup step", func() {
+		config, secret, project := deletedConfig("finalize-resume", customergardenerv1.DeletionPolicyDelete)
+		// a previous attempt already handled the secret, the project failed
+		config.Status.Cleanup = &customergardenerv1.CleanupStatus{
+			Secret:    customergardenerv1.CleanupKept,
+			Project:   customergardenerv1.CleanupFailed,
+			LastError: "ArgoCD Project: timeout",
+		}
+		Expect(k8sClient.Status().Update(ctx, config)).To(Succeed())
+
+		_, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists(secret)).To(BeTrue())
+		Expect(exists(project)).To(BeFalse())
+		Expect(config.Status.Cleanup.Secret).To(Equal(customergardenerv1.CleanupKept))
+		Expect(config.Status.Cleanup.Project).To(Equal(customergardenerv1.CleanupDeleted))
+		Expect(config.Status.Cleanup.LastError).To(BeEmpty())
+		Expect(config.Finalizers).To(ConsistOf(otherFinalizer))
+	})
+
+	It("removes the cluster from a remote ArgoCD set only in the operator defaults", func() {
+		requireEnvtest()
+		var mu sync.Mutex
+		var deleted []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if req.Method == http.MethodDelete && req.Header.Get("Authorization") == "Bearer argocd-token" {
+				deleted = append(deleted, req.URL.Path)
+				return
+			}
+			w.WriteHeader(http.StatusNotImplemented)
+		}))
+		DeferCleanup(server.Close)
+
+		token := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "finalize-remote-token", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte("argocd-token")},
+		}
+		Expect(k8sClient.Create(ctx, token)).To(Succeed())
+		config := &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{Name: "finalize-remote", Namespace: "default", Finalizers: []string{configFinalizer}},
+			Spec:       customergardenerv1.ConfigSpec{DesiredOutput: "ArgoCD", Project: "abc", Shoot: "finalize-remote"},
+		}
+		Expect(k8sClient.Create(ctx, config)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, token))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(config), config))).To(Succeed())
+			config.Finalizers = nil
+			Expect(client.IgnoreNotFound(k8sClient.Update(ctx, config))).To(Succeed())
+		})
+		config.Status.Remote = &customergardenerv1.RemoteStatus{Server: server.URL, Cluster: "https://api.finalize-remote.example.com"}
+		Expect(k8sClient.Status().Update(ctx, config)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, config)).To(Succeed())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(config), config)).To(Succeed())
+
+		settings := operatorconfig.DefaultConfiguration()
+		settings.Defaults.ArgoCD = &customergardenerv1.ArgoCDOutput{Remote: &customergardenerv1.ArgoCDRemote{
+			Server:         server.URL,
+			TokenSecretRef: customergardenerv1.SecretKeyRef{Name: "finalize-remote-token", Key: "token"},
+		}}
+		r := &ConfigReconciler{Client: k8sClient, Scheme: scheme.Scheme, Operator: operatorconfig.NewStore(settings)}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+		Expect(err).NotTo(HaveOccurred())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(deleted).To(ConsistOf("/api/v1/clusters/https://api.finalize-remote.example.com"))
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(config), config)
+		Expect(errors.IsNotFound(err) || !controllerutil.ContainsFinalizer(config, configFinalizer)).To(BeTrue())
+	})
+})
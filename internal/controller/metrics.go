@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	suspendedConfigs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gardener_config_suspended_configs",
+		Help: "Number of Configs with suspended reconciliation",
+	})
+
+	suspended = &configSet{items: map[types.NamespacedName]struct{}{}}
+
+	rotationFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gardener_config_rotation_failures_total",
+		Help: "Number of failed attempts to issue credentials",
+	})
+	rotationsAtRiskConfigs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gardener_config_rotations_at_risk",
+		Help: "Number of Configs whose rotation keeps failing beyond the retry budget or close to the expiry of the credentials",
+	})
+
+	rotationsAtRisk = &configSet{items: map[types.NamespacedName]struct{}{}}
+)
+
+func init() {
+	metrics.Registry.MustRegister(suspendedConfigs, rotationFailures, rotationsAtRiskConfigs)
+}
+
+// configSet tracks configs in a state and exports their number to a gauge
+type configSet struct {
+	mu    sync.Mutex
+	items map[types.NamespacedName]struct{}
+}
+
+func (s *configSet) set(name types.NamespacedName, in bool, gauge prometheus.Gauge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in {
+		s.items[name] = struct{}{}
+	} else {
+		delete(s.items, name)
+	}
+	gauge.Set(float64(len(s.items)))
+}
@@ -0,0 +1,454 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/argocd"
+	"customer.gardener/config/pkg/gardener"
+)
+
+// labels and annotations of the secrets holding role tokens
+const (
+	// name of the config a token secret belongs to
+	tokenConfigLabel = "configs.customer.gardener/config"
+	// UID of the config a token secret belongs to, a ClusterConfig and a Config of the same
+	// name share the target namespace
+	tokenConfigUIDLabel = "configs.customer.gardener/config-uid"
+	// role the token was issued for
+	tokenRoleAnnotation = "configs.customer.gardener/role"
+	// iat claim of the token, used to delete it at ArgoCD again
+	tokenIssuedAtAnnotation = "configs.customer.gardener/token-iat"
+	// time the token expires, empty for tokens without expiry
+	tokenExpiresAtAnnotation = "configs.customer.gardener/expires-at"
+)
+
+// reconcileProject keeps the part of the AppProject the config owns in line with the config
+// where ArgoCD lives, server is the API server of the shoot. Configs naming the same project
+// share it, each adds its destination and roles. The project is only written if its rendered
+// content or the destination and roles of the config changed.
+func (r *ConfigReconciler) reconcileProject(ctx context.Context, config *customergardenerv1.Config, server string) error {
+	if config.Spec.DesiredOutput != "ArgoCD" || server == "" {
+		return nil
+	}
+
+	// a project which can not be rendered is a problem of the spec, retrying does not help
+	name, err := argocd.ProjectName(config)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Unable to render ArgoCD Project")
+		setCondition(config, customergardenerv1.ConditionProjectFailed, metav1.ConditionTrue, "InvalidName", err.Error())
+		return nil
+	}
+	// the config moved to another project, leave the previous one
+	if config.Status.ProjectName != "" && config.Status.ProjectName != name {
+		if err := r.deleteProject(ctx, config); err != nil {
+			return err
+		}
+		config.Status.ProjectName = ""
+		config.Status.ProjectHash = ""
+		config.Status.ProjectDestination = ""
+		config.Status.ProjectRoles = nil
+	}
+
+	project, err := argocd.ConfigProject(config, config.Namespace, server)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Unable to render ArgoCD Project")
+		setCondition(config, customergardenerv1.ConditionProjectFailed, metav1.ConditionTrue, "RenderFailed", err.Error())
+		return nil
+	}
+	setCondition(config, customergardenerv1.ConditionProjectFailed, metav1.ConditionFalse, "Rendered", "")
+	roles := make([]string, 0, len(project.Spec.Roles))
+	for _, role := range project.Spec.Roles {
+		roles = append(roles, role.Name)
+	}
+	hash, err := argocd.Hash(project)
+	if err != nil {
+		return err
+	}
+	if config.Status.ProjectName != name || config.Status.ProjectHash != hash ||
+		config.Status.ProjectDestination != server || !equalStrings(config.Status.ProjectRoles, roles) {
+		log.FromContext(ctx).Info("Create Project")
+		others, err := r.projectReferences(ctx, config, name)
+		if err != nil {
+			return err
+		}
+		input := &argocd.Input{
+			S:     config,
+			Owned: config.Status.ProjectName == name,
+		}
+		if old := config.Status.ProjectDestination; old != "" && old != server && !others.server(old) {
+			input.StaleServers = []string{old}
+		}
+		for _, role := range config.Status.ProjectRoles {
+			if !containsString(roles, role) && !others.role(role) {
+				input.StaleRoles = append(input.StaleRoles, role)
+			}
+		}
+
+		if remoteArgoCD(config) {
+			c, err := r.argoCDClient(ctx, config)
+			if err != nil {
+				return err
+			}
+			if err := c.ApplyProject(ctx, input, server); err != nil {
+				return err
+			}
+		} else if err := r.createLocalProject(ctx, input, server); err != nil {
+			return err
+		}
+		config.Status.ProjectName = name
+		config.Status.ProjectHash = hash
+		config.Status.ProjectDestination = server
+		config.Status.ProjectRoles = roles
+	}
+
+	return r.reconcileRoleTokens(ctx, config)
+}
+
+// deleteProject removes the AppProject recorded in the status where ArgoCD lives together
+// with the role tokens issued for it. A project other configs still use only loses the
+// destination and the roles of the config.
+func (r *ConfigReconciler) deleteProject(ctx context.Context, config *customergardenerv1.Config) error {
+	if err := r.deleteRoleTokens(ctx, config, nil); err != nil {
+		return err
+	}
+	name := config.Status.ProjectName
+	others, err := r.projectReferences(ctx, config, name)
+	if err != nil {
+		return err
+	}
+
+	var c *argocd.APIClient
+	if remoteArgoCD(config) {
+		if c, err = r.argoCDClient(ctx, config); err != nil {
+			return err
+		}
+	}
+	if len(others) == 0 {
+		if c != nil {
+			return c.DeleteProject(ctx, name)
+		}
+		ctx, cancel := r.argoCDContext(ctx)
+		defer cancel()
+		return argocd.DeleteProject(ctx, r.Client, config.Namespace, name)
+	}
+
+	log.FromContext(ctx).Info(fmt.Sprintf("ArgoCD Project %s is used by %d other configs, only remove the shoot", name, len(others)))
+	var servers, roles []string
+	if server := config.Status.ProjectDestination; server != "" && !others.server(server) {
+		servers = []string{server}
+	}
+	for _, role := range config.Status.ProjectRoles {
+		if !others.role(role) {
+			roles = append(roles, role)
+		}
+	}
+	if c != nil {
+		return c.ReleaseProject(ctx, name, servers, roles)
+	}
+	ctx, cancel := r.argoCDContext(ctx)
+	defer cancel()
+	return argocd.ReleaseProject(ctx, r.Client, config.Namespace, name, servers, roles)
+}
+
+// createLocalProject creates or updates the AppProject where the operator runs
+func (r *ConfigReconciler) createLocalProject(ctx context.Context, input *argocd.Input, server string) error {
+	ctx, cancel := r.argoCDContext(ctx)
+	defer cancel()
+	return argocd.CreateProject(ctx, r.Client, input, server)
+}
+
+// projectUsers are the other configs sharing a project
+type projectUsers []customergardenerv1.Config
+
+// server reports whether one of the configs added the destination server
+func (u projectUsers) server(server string) bool {
+	for i := range u {
+		if u[i].Status.ProjectDestination == server {
+			return true
+		}
+	}
+	return false
+}
+
+// role reports whether one of the configs added the role
+func (u projectUsers) role(role string) bool {
+	for i := range u {
+		if containsString(u[i].Status.ProjectRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectReferences returns the other configs using the project in the same ArgoCD, including
+// ClusterConfigs, configs being deleted do not count. The projects of the ArgoCD next to the
+// operator live in the namespace of the config, the ones of a remote ArgoCD are shared by the
+// configs of all namespaces registering there.
+func (r *ConfigReconciler) projectReferences(ctx context.Context, config *customergardenerv1.Config, name string) (projectUsers, error) {
+	configs := &customergardenerv1.ConfigList{}
+	var opts []client.ListOption
+	if !remoteArgoCD(config) {
+		opts = append(opts, client.InNamespace(config.Namespace))
+	}
+	if err := r.Client.List(ctx, configs, opts...); err != nil {
+		return nil, err
+	}
+	clusterConfigs := &customergardenerv1.ClusterConfigList{}
+	if err := r.Client.List(ctx, clusterConfigs); err != nil {
+		return nil, err
+	}
+	for i := range clusterConfigs.Items {
+		configs.Items = append(configs.Items, *clusterConfigs.Items[i].Config())
+	}
+	location := projectLocation(config)
+	users := projectUsers{}
+	for _, other := range configs.Items {
+		if other.UID == config.UID || other.Status.ProjectName != name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if projectLocation(&other) != location {
+			continue
+		}
+		users = append(users, other)
+	}
+	return users, nil
+}
+
+// projectLocation identifies the ArgoCD holding the project of the config, the remote server
+// or the namespace of the config
+func projectLocation(config *customergardenerv1.Config) string {
+	if remoteArgoCD(config) {
+		return "remote:" + strings.TrimSuffix(config.Spec.ArgoCD.Remote.Server, "/")
+	}
+	return "namespace:" + config.Namespace
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenClient returns the ArgoCD API client used to issue role tokens
+func (r *ConfigReconciler) tokenClient(ctx context.Context, config *customergardenerv1.Config) (*argocd.APIClient, error) {
+	if config.Spec.AppProject != nil && config.Spec.AppProject.API != nil {
+		api := config.Spec.AppProject.API
+		token, err := r.secretKey(ctx, config.Namespace, api.TokenSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return r.newArgoCDClient(api.Server, token, api.CABundle)
+	}
+	if remoteArgoCD(config) {
+		return r.argoCDClient(ctx, config)
+	}
+	return nil, fmt.Errorf("role tokens need the ArgoCD API, set spec.appProject.api or spec.argocd.remote")
+}
+
+// reconcileRoleTokens issues the tokens of the project roles which are missing or about to
+// expire and removes the tokens of roles which no longer want one
+func (r *ConfigReconciler) reconcileRoleTokens(ctx context.Context, config *customergardenerv1.Config) error {
+	wanted := map[string]bool{}
+	if config.Spec.AppProject != nil {
+		for _, role := range config.Spec.AppProject.Roles {
+			if role.Token == nil {
+				continue
+			}
+			wanted[role.Token.SecretName] = true
+			if err := r.issueRoleToken(ctx, config, role); err != nil {
+				return err
+			}
+		}
+	}
+	return r.deleteRoleTokens(ctx, config, wanted)
+}
+
+// issueRoleToken stores a new token of the role in its secret unless the current one stays
+// valid until the next reconcile
+func (r *ConfigReconciler) issueRoleToken(ctx context.Context, config *customergardenerv1.Config, role customergardenerv1.ProjectRole) error {
+	secret := &v1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: config.Namespace, Name: role.Token.SecretName}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists {
+		if !r.ownsTokenSecret(config, secret) {
+			return fmt.Errorf("secret %s for the token of role %s is not managed by the config", secret.Name, role.Name)
+		}
+		if secret.Annotations[tokenRoleAnnotation] == role.Name && len(secret.Data["token"]) > 0 &&
+			!tokenExpiresSoon(secret, config.Spec.Frequency.Duration+r.Operator.Get().Rotation.Skew.Duration) {
+			return nil
+		}
+	}
+
+	c, err := r.tokenClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	var expiresIn int64
+	if role.Token.ExpiresIn != nil {
+		expiresIn = int64(role.Token.ExpiresIn.Duration.Seconds())
+	}
+	now := time.Now().UTC()
+	token, err := c.IssueRoleToken(ctx, config.Status.ProjectName, role.Name, fmt.Sprintf("%s-%d", role.Token.SecretName, now.Unix()), expiresIn)
+	if err != nil {
+		return err
+	}
+	iat, err := argocd.TokenIssuedAt(token)
+	if err != nil {
+		return err
+	}
+
+	previous := *secret.DeepCopy()
+	secret.Namespace = config.Namespace
+	secret.Name = role.Token.SecretName
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[customergardenerv1.ManagedByLabel] = customergardenerv1.ManagedByValue
+	secret.Labels[tokenConfigLabel] = config.Name
+	secret.Labels[tokenConfigUIDLabel] = string(config.UID)
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[tokenRoleAnnotation] = role.Name
+	secret.Annotations[tokenIssuedAtAnnotation] = strconv.FormatInt(iat, 10)
+	secret.Annotations[gardener.IssuedAtAnnotation] = now.Format(time.RFC3339)
+	delete(secret.Annotations, tokenExpiresAtAnnotation)
+	if expiresIn > 0 {
+		secret.Annotations[tokenExpiresAtAnnotation] = now.Add(role.Token.ExpiresIn.Duration).Format(time.RFC3339)
+	}
+	secret.Data = map[string][]byte{"token": []byte(token)}
+
+	log.FromContext(ctx).Info(fmt.Sprintf("Issued token for role %s of project %s", role.Name, config.Status.ProjectName))
+	if !exists {
+		return r.Client.Create(ctx, secret)
+	}
+	if err := r.Client.Update(ctx, secret); err != nil {
+		return err
+	}
+	// the replaced token must not stay valid
+	return r.deleteTokenAt(ctx, c, config, &previous)
+}
+
+// tokenExpiresSoon reports whether the token of the secret expires within the period, the
+// time until the next reconcile plus the rotation skew
+func tokenExpiresSoon(secret *v1.Secret, period time.Duration) bool {
+	value, ok := secret.Annotations[tokenExpiresAtAnnotation]
+	if !ok {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return true
+	}
+	return time.Now().Add(period).After(expiresAt)
+}
+
+// deleteRoleTokens removes the token secrets of the config which are not wanted, all of them
+// if wanted is nil, and the tokens at ArgoCD
+func (r *ConfigReconciler) deleteRoleTokens(ctx context.Context, config *customergardenerv1.Config, wanted map[string]bool) error {
+	secrets := &v1.SecretList{}
+	if err := r.Client.List(ctx, secrets,
+		client.InNamespace(config.Namespace),
+		client.MatchingLabels{tokenConfigLabel: config.Name}); err != nil {
+		return err
+	}
+	var c *argocd.APIClient
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if wanted[secret.Name] || !r.ownsTokenSecret(config, secret) {
+			continue
+		}
+		if c == nil {
+			var err error
+			if c, err = r.tokenClient(ctx, config); err != nil {
+				return err
+			}
+		}
+		if err := r.deleteTokenAt(ctx, c, config, secret); err != nil {
+			return err
+		}
+		if err := r.Client.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownsTokenSecret reports whether the token secret belongs to the config. Secrets written before
+// the UID label only carry the name, they are left to the namespaced Config of that name.
+func (r *ConfigReconciler) ownsTokenSecret(config *customergardenerv1.Config, secret *v1.Secret) bool {
+	if uid, ok := secret.Labels[tokenConfigUIDLabel]; ok {
+		return uid == string(config.UID)
+	}
+	_, namespaced := r.objects().(*namespacedConfigStore)
+	return namespaced && secret.Labels[tokenConfigLabel] == config.Name
+}
+
+// deleteTokenAt removes the token stored in the secret from its role at ArgoCD
+func (r *ConfigReconciler) deleteTokenAt(ctx context.Context, c *argocd.APIClient, config *customergardenerv1.Config, secret *v1.Secret) error {
+	role := secret.Annotations[tokenRoleAnnotation]
+	iat, err := strconv.ParseInt(secret.Annotations[tokenIssuedAtAnnotation], 10, 64)
+	if role == "" || err != nil || config.Status.ProjectName == "" {
+		return nil
+	}
+	return c.DeleteRoleToken(ctx, config.Status.ProjectName, role, iat)
+}
+
+// secretKey reads a key of a secret in the namespace
+func (r *ConfigReconciler) secretKey(ctx context.Context, namespace string, ref customergardenerv1.SecretKeyRef) (string, error) {
+	secret := &v1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		return "", fmt.Errorf("unable to read secret %s.\n%s -", ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s missing in secret %s", ref.Key, ref.Name)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
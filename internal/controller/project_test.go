@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+var _ = Describe("Project references", func() {
+	ctx := context.Background()
+
+	// projectConfig creates a config using the project abc at the given remote ArgoCD
+	projectConfig := func(name, namespace, server string) *customergardenerv1.Config {
+		requireEnvtest()
+		config := &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       customergardenerv1.ConfigSpec{DesiredOutput: "ArgoCD", Project: "abc", Shoot: name},
+		}
+		if server != "" {
+			config.Spec.ArgoCD = &customergardenerv1.ArgoCDOutput{Remote: &customergardenerv1.ArgoCDRemote{
+				Server:         server,
+				TokenSecretRef: customergardenerv1.SecretKeyRef{Name: "argocd-token", Key: "token"},
+			}}
+		}
+		Expect(k8sClient.Create(ctx, config)).To(Succeed())
+		config.Status.ProjectName = "abc"
+		Expect(k8sClient.Status().Update(ctx, config)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, config))).To(Succeed())
+		})
+		return config
+	}
+
+	It("counts the configs of all namespaces using the same remote ArgoCD", func() {
+		config := projectConfig("project-remote1", "default", "https://argocd.example.com")
+		projectConfig("project-remote2", "kube-public", "https://argocd.example.com/")
+		projectConfig("project-other", "kube-public", "https://argocd.other.example.com")
+		projectConfig("project-local", "default", "")
+
+		users, err := newTestReconciler().projectReferences(ctx, config, "abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(ConsistOf(HaveField("Name", "project-remote2")))
+	})
+})
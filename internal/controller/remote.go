@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/argocd"
+)
+
+// remoteArgoCD reports whether the cluster is registered at a remote ArgoCD instead of a local secret
+func remoteArgoCD(config *customergardenerv1.Config) bool {
+	return config.Spec.DesiredOutput == "ArgoCD" && config.Spec.ArgoCD != nil && config.Spec.ArgoCD.Remote != nil
+}
+
+// argoCDClient returns a client for the remote ArgoCD of the config, authenticated with the
+// token of the referenced secret which is read on every call to pick up a rotated token
+func (r *ConfigReconciler) argoCDClient(ctx context.Context, config *customergardenerv1.Config) (*argocd.APIClient, error) {
+	out := config.Spec.ArgoCD.Remote
+	token, err := r.secretKey(ctx, config.Namespace, out.TokenSecretRef)
+	if err != nil {
+		return nil, err
+	}
+	return r.newArgoCDClient(out.Server, token, out.CABundle)
+}
+
+// newArgoCDClient returns an ArgoCD API client whose requests are bounded by the configured timeout
+func (r *ConfigReconciler) newArgoCDClient(server string, token string, caBundle string) (*argocd.APIClient, error) {
+	c, err := argocd.NewAPIClient(server, token, caBundle)
+	if err != nil {
+		return nil, err
+	}
+	c.HTTP.Timeout = r.Operator.Get().Timeouts.ArgoCD.Duration
+	return c, nil
+}
+
+// argoCDContext bounds a request to the AppProjects and Applications of the local ArgoCD by the
+// configured timeout
+func (r *ConfigReconciler) argoCDContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.Operator.Get().Timeouts.ArgoCD.Duration)
+}
+
+// registerRemote registers the cluster of the generated secret at the remote ArgoCD and
+// removes a registration left over from a previous API server of the shoot
+func (r *ConfigReconciler) registerRemote(ctx context.Context, config *customergardenerv1.Config, secret *v1.Secret) error {
+	c, err := r.argoCDClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	cluster, err := argocd.ClusterFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	if err := c.UpsertCluster(ctx, cluster); err != nil {
+		return err
+	}
+	previous := config.Status.Remote
+	if previous != nil && previous.Server == c.Server && previous.Cluster != cluster.Server {
+		if err := c.DeleteCluster(ctx, previous.Cluster); err != nil {
+			return err
+		}
+	}
+	config.Status.Remote = &customergardenerv1.RemoteStatus{Server: c.Server, Cluster: cluster.Server}
+	return nil
+}
+
+// deleteRemote removes the cluster registered at the remote ArgoCD
+func (r *ConfigReconciler) deleteRemote(ctx context.Context, config *customergardenerv1.Config) error {
+	if config.Status.Remote == nil || !remoteArgoCD(config) {
+		return nil
+	}
+	c, err := r.argoCDClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	if err := c.DeleteCluster(ctx, config.Status.Remote.Cluster); err != nil {
+		return err
+	}
+	config.Status.Remote = nil
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/operatorconfig"
+)
+
+// rotationFailed records a failed attempt to issue credentials and schedules the next one. The
+// backoff grows exponentially but never exceeds a quarter of the remaining lifetime of the
+// current credentials, so retries get more aggressive as they approach their expiry.
+func (r *ConfigReconciler) rotationFailed(ctx context.Context, config *customergardenerv1.Config, cause error, settings *operatorconfig.OperatorConfiguration) (ctrl.Result, error) {
+	// the manager is shutting down or lost the leader election, this is not a failed attempt
+	if ctx.Err() != nil {
+		return ctrl.Result{}, ctx.Err()
+	}
+	policy := settings.Rotation.Retry
+	now := time.Now()
+	retry := config.Status.Retry
+	if retry == nil {
+		retry = &customergardenerv1.RetryStatus{}
+		config.Status.Retry = retry
+	}
+	retry.Attempts++
+	retry.LastError = cause.Error()
+	retry.LastAttempt = &metav1.Time{Time: now}
+	retry.ObservedGeneration = config.Generation
+	rotationFailures.Inc()
+
+	backoff := policy.InitialBackoff.Duration
+	for i := int32(1); i < retry.Attempts && backoff < policy.MaxBackoff.Duration; i++ {
+		backoff *= 2
+	}
+	if backoff > policy.MaxBackoff.Duration {
+		backoff = policy.MaxBackoff.Duration
+	}
+	notAfter, valid := credentialNotAfter(config, settings)
+	headroom := notAfter.Sub(now)
+	if valid && backoff > headroom/4 {
+		backoff = headroom / 4
+	}
+	if backoff < policy.MinBackoff.Duration {
+		backoff = policy.MinBackoff.Duration
+	}
+	retry.NextAttempt = &metav1.Time{Time: now.Add(backoff)}
+
+	atRisk := retry.Attempts > policy.Budget || (valid && headroom < policy.CriticalWindow.Duration)
+	rotationsAtRisk.set(r.objects().key(config), atRisk, rotationsAtRiskConfigs)
+	reason, message := "Retrying", fmt.Sprintf("Attempt %d failed, retrying in %s: %s", retry.Attempts, backoff.Round(time.Second), cause)
+	if atRisk {
+		reason = "AtRisk"
+		if valid {
+			message = fmt.Sprintf("Attempt %d failed, the current credentials expire at %s, retrying in %s: %s",
+				retry.Attempts, notAfter.UTC().Format(time.RFC3339), backoff.Round(time.Second), cause)
+		}
+		log.FromContext(ctx).Error(cause, "Rotation at risk", "attempts", retry.Attempts, "notAfter", notAfter)
+	} else {
+		log.FromContext(ctx).Info(message)
+	}
+	setCondition(config, customergardenerv1.ConditionRotationFailed, metav1.ConditionTrue, reason, message)
+
+	if err := r.updateConfigStatus(ctx, config); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: backoff}, nil
+}
+
+// retryPending returns how long a failed rotation still has to back off. The status update of
+// the failure triggers a reconcile right away, it must not become the next attempt.
+func retryPending(config *customergardenerv1.Config, now time.Time) time.Duration {
+	retry := config.Status.Retry
+	if retry == nil || retry.NextAttempt == nil || retry.ObservedGeneration != config.Generation {
+		return 0
+	}
+	return retry.NextAttempt.Sub(now)
+}
+
+// rotationSucceeded clears the failed attempts after credentials were issued
+func (r *ConfigReconciler) rotationSucceeded(config *customergardenerv1.Config) {
+	config.Status.Retry = nil
+	rotationsAtRisk.set(r.objects().key(config), false, rotationsAtRiskConfigs)
+	setCondition(config, customergardenerv1.ConditionRotationFailed, metav1.ConditionFalse, "Issued", "")
+}
+
+// credentialNotAfter returns the expiry of the current credentials, estimated from the last
+// issuance if the credential does not tell. It is not valid if nothing was issued yet.
+func credentialNotAfter(config *customergardenerv1.Config, settings *operatorconfig.OperatorConfiguration) (time.Time, bool) {
+	if c := config.Status.Credential; c != nil && c.NotAfter != nil {
+		return c.NotAfter.Time, true
+	}
+	if config.Status.LastUpdatedTime == nil {
+		return time.Time{}, false
+	}
+	return config.Status.LastUpdatedTime.Add(config.Spec.Frequency.Duration + settings.Rotation.SafetyMargin.Duration), true
+}
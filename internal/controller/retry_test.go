@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+var _ = Describe("Rotation retries", func() {
+	ctx := context.Background()
+
+	It("waits for the backoff of a failed rotation", func() {
+		requireEnvtest()
+		config := &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{Name: "retry", Namespace: "default", Finalizers: []string{configFinalizer}},
+			Spec:       customergardenerv1.ConfigSpec{DesiredOutput: "Plain", Project: "abc", Shoot: "abc-dev"},
+		}
+		Expect(k8sClient.Create(ctx, config)).To(Succeed())
+		DeferCleanup(func() {
+			config.Finalizers = nil
+			Expect(k8sClient.Update(ctx, config)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, config)).To(Succeed())
+		})
+
+		last := metav1.NewTime(time.Now())
+		next := metav1.NewTime(time.Now().Add(10 * time.Minute))
+		config.Status.Retry = &customergardenerv1.RetryStatus{
+			Attempts:           2,
+			LastAttempt:        &last,
+			NextAttempt:        &next,
+			ObservedGeneration: config.Generation,
+		}
+		Expect(k8sClient.Status().Update(ctx, config)).To(Succeed())
+
+		// without the wait the reconcile would request credentials from the unreachable garden
+		result, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 10*time.Minute, time.Minute))
+		Expect(config.Status.Retry.Attempts).To(Equal(int32(2)))
+		Expect(config.Status.Retry.NextAttempt.Time).To(BeTemporally("~", next.Time, time.Second))
+	})
+
+	It("retries at once after the spec changed", func() {
+		next := metav1.NewTime(time.Now().Add(10 * time.Minute))
+		config := &customergardenerv1.Config{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+		config.Status.Retry = &customergardenerv1.RetryStatus{Attempts: 1, NextAttempt: &next, ObservedGeneration: 2}
+		Expect(retryPending(config, time.Now())).To(BeZero())
+
+		config.Status.Retry.ObservedGeneration = 3
+		Expect(retryPending(config, time.Now())).To(BeNumerically("~", 10*time.Minute, time.Second))
+	})
+})
@@ -0,0 +1,199 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/gardener"
+)
+
+// revocationBlocked reports whether a revocation waits for the shoot credentials rotation or
+// for its acknowledgement
+func revocationBlocked(config *customergardenerv1.Config) bool {
+	return config.Status.Revocation != nil && !config.Status.Revocation.Acknowledged
+}
+
+// shootRotationPending reports whether the credentials rotation started by the revocation is
+// not completed yet, the revoked client certificates are still valid until then
+func shootRotationPending(revocation *customergardenerv1.RevocationStatus) bool {
+	return revocation.ShootCredentialsRotation && revocation.ShootCredentialsRotationPhase != customergardenerv1.RevocationRotationCompleted
+}
+
+// reconcileRevocation handles the revoke and acknowledge annotations. It returns true if the
+// reconcile ends here because credentials were revoked or a revocation is not finished or
+// acknowledged yet.
+func (r *ConfigReconciler) reconcileRevocation(ctx context.Context, config *customergardenerv1.Config) (bool, ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+	revocation := config.Status.Revocation
+	revokeID := config.Annotations[customergardenerv1.RevokeAnnotation]
+
+	if revokeID != "" && (revocation == nil || revocation.ID != revokeID) {
+		reqLogger.Info(fmt.Sprintf("Revoke credentials of %s/%s", config.Namespace, config.Name), "revocation", revokeID)
+		if err := r.revoke(ctx, config, revokeID); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		if err := r.updateConfigStatus(ctx, config); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		return true, revocationRequeue(config.Status.Revocation), nil
+	}
+
+	if revocation != nil && shootRotationPending(revocation) {
+		if err := r.advanceShootRotation(ctx, config); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		if err := r.updateConfigStatus(ctx, config); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		return true, revocationRequeue(revocation), nil
+	}
+
+	if revocation != nil && !revocation.Acknowledged &&
+		config.Annotations[customergardenerv1.RevokeAcknowledgedAnnotation] == revocation.ID {
+		reqLogger.Info(fmt.Sprintf("Revocation of %s/%s acknowledged", config.Namespace, config.Name), "revocation", revocation.ID)
+		revocation.Acknowledged = true
+		now := metav1.Now()
+		revocation.AcknowledgedAt = &now
+		if err := r.updateConfigStatus(ctx, config); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		return false, ctrl.Result{}, nil
+	}
+
+	return revocationBlocked(config), ctrl.Result{}, nil
+}
+
+// revocationRequeue polls the shoot while its credentials rotation is pending
+func revocationRequeue(revocation *customergardenerv1.RevocationStatus) ctrl.Result {
+	if shootRotationPending(revocation) {
+		return ctrl.Result{RequeueAfter: caRotationRequeue}
+	}
+	return ctrl.Result{}
+}
+
+// revoke removes every output of the config at once, optionally starts a credentials rotation
+// of the shoot and records the revocation in the status
+func (r *ConfigReconciler) revoke(ctx context.Context, config *customergardenerv1.Config, revokeID string) error {
+	if !skipSecret(config) {
+		if err := r.deleteSecret(ctx, config); err != nil {
+			return err
+		}
+	}
+	if err := r.deleteBootstrap(ctx, config); err != nil {
+		return err
+	}
+	if config.Status.ProjectName != "" {
+		if err := r.deleteProject(ctx, config); err != nil {
+			return err
+		}
+		config.Status.ProjectName = ""
+	}
+	if err := r.deleteVault(ctx, config); err != nil {
+		return err
+	}
+	if err := r.deleteRemote(ctx, config); err != nil {
+		return err
+	}
+
+	rotationStarted := false
+	if r.Operator.Get().RevokeRotatesShootCredentials {
+		if err := gardener.StartShootOperation(ctx, config.Spec.Project, config.Spec.Shoot, gardener.OperationRotateCredentialsStart); err != nil {
+			return err
+		}
+		rotationStarted = true
+	}
+
+	r.auditDelete(ctx, config, "revoked")
+
+	now := metav1.Now()
+	config.Status.Revocation = &customergardenerv1.RevocationStatus{
+		ID:                       revokeID,
+		RevokedAt:                &now,
+		Credential:               config.Status.Credential,
+		ShootCredentialsRotation: rotationStarted,
+	}
+	config.Status.Phase = "Revoked"
+	if rotationStarted {
+		config.Status.Revocation.ShootCredentialsRotationPhase = customergardenerv1.RevocationRotationPreparing
+		config.Status.Phase = "Revoking"
+	}
+	// issue from scratch once the revocation is acknowledged
+	config.Status.LastUpdatedTime = nil
+	config.Status.Credential = nil
+	return nil
+}
+
+// advanceShootRotation completes the credentials rotation of the shoot once gardener prepared
+// it and records when it is done. Only then the revoked client certificates are invalid.
+func (r *ConfigReconciler) advanceShootRotation(ctx context.Context, config *customergardenerv1.Config) error {
+	reqLogger := log.FromContext(ctx)
+	revocation := config.Status.Revocation
+	info, err := gardener.GetInfo(ctx, config.Spec.Project, config.Spec.Shoot)
+	if err != nil {
+		return err
+	}
+
+	switch revocation.ShootCredentialsRotationPhase {
+	case customergardenerv1.RevocationRotationCompleting:
+		if info.CARotationPhase == gardener.CARotationCompleted {
+			reqLogger.Info(fmt.Sprintf("Credentials rotation of shoot %s completed", config.Spec.Shoot), "revocation", revocation.ID)
+			revocation.ShootCredentialsRotationPhase = customergardenerv1.RevocationRotationCompleted
+			config.Status.Phase = "Revoked"
+		}
+	default:
+		// a phase left over from an earlier rotation is never Prepared
+		if info.CARotationPhase == gardener.CARotationPrepared {
+			reqLogger.Info(fmt.Sprintf("Complete credentials rotation of shoot %s", config.Spec.Shoot), "revocation", revocation.ID)
+			if err := gardener.StartShootOperation(ctx, config.Spec.Project, config.Spec.Shoot, gardener.OperationRotateCredentialsComplete); err != nil {
+				return err
+			}
+			revocation.ShootCredentialsRotationPhase = customergardenerv1.RevocationRotationCompleting
+		}
+	}
+	return nil
+}
+
+// finish a deletion while a revocation blocks issuing, the outputs are already gone. A pending
+// credentials rotation of the shoot is completed first.
+func (r *ConfigReconciler) finalizeRevoked(ctx context.Context, config *customergardenerv1.Config) (ctrl.Result, error) {
+	if revocation := config.Status.Revocation; shootRotationPending(revocation) && controllerutil.ContainsFinalizer(config, configFinalizer) {
+		if err := r.advanceShootRotation(ctx, config); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.updateConfigStatus(ctx, config); err != nil {
+			return ctrl.Result{}, err
+		}
+		if shootRotationPending(revocation) {
+			return revocationRequeue(revocation), nil
+		}
+	}
+	if controllerutil.RemoveFinalizer(config, configFinalizer) {
+		if err := r.updateConfig(ctx, config); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	log.FromContext(ctx).Info("CR Deleted")
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+var _ = Describe("Revocation", func() {
+	ctx := context.Background()
+
+	// revokedConfig creates a config with the revoke annotation and the secret of its shoot
+	revokedConfig := func(name string, secretLabels map[string]string) (*customergardenerv1.Config, *v1.Secret) {
+		requireEnvtest()
+		config := &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Finalizers:  []string{configFinalizer},
+				Annotations: map[string]string{customergardenerv1.RevokeAnnotation: "leak-1"},
+			},
+			Spec: customergardenerv1.ConfigSpec{DesiredOutput: "Plain", Project: "abc", Shoot: name},
+		}
+		Expect(k8sClient.Create(ctx, config)).To(Succeed())
+		secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name + "-plain", Namespace: "default", Labels: secretLabels}}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, secret))).To(Succeed())
+			config.Finalizers = nil
+			Expect(client.IgnoreNotFound(k8sClient.Update(ctx, config))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, config))).To(Succeed())
+		})
+		return config, secret
+	}
+
+	It("deletes the secret of the operator and blocks until acknowledged", func() {
+		config, secret := revokedConfig("revoke-owned", map[string]string{
+			customergardenerv1.ManagedByLabel: customergardenerv1.ManagedByValue,
+		})
+
+		_, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(config.Status.Phase).To(Equal("Revoked"))
+		Expect(config.Status.Revocation.ID).To(Equal("leak-1"))
+		Expect(revocationBlocked(config)).To(BeTrue())
+
+		config.Annotations[customergardenerv1.RevokeAcknowledgedAnnotation] = "leak-1"
+		Expect(k8sClient.Update(ctx, config)).To(Succeed())
+		blocked, _, err := newTestReconciler().reconcileRevocation(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocked).To(BeFalse())
+		Expect(config.Status.Revocation.Acknowledged).To(BeTrue())
+	})
+
+	It("keeps a secret the operator does not own", func() {
+		config, secret := revokedConfig("revoke-foreign", map[string]string{"team": "platform"})
+
+		_, err := reconcileConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal("Revoked"))
+	})
+
+	It("is not finished before the credentials rotation of the shoot completed", func() {
+		revocation := &customergardenerv1.RevocationStatus{
+			ID:                            "leak-1",
+			ShootCredentialsRotation:      true,
+			ShootCredentialsRotationPhase: customergardenerv1.RevocationRotationPreparing,
+		}
+		Expect(shootRotationPending(revocation)).To(BeTrue())
+		Expect(revocationRequeue(revocation).RequeueAfter).To(Equal(caRotationRequeue))
+
+		revocation.ShootCredentialsRotationPhase = customergardenerv1.RevocationRotationCompleted
+		Expect(shootRotationPending(revocation)).To(BeFalse())
+		Expect(revocationRequeue(revocation).RequeueAfter).To(BeZero())
+	})
+})
@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"customer.gardener/config/pkg/gardener"
+)
+
+// how long an assigned shard counts without its secret, long enough for the secret to be
+// written and to reach the cache
+const shardReservationTTL = time.Minute
+
+// shardReservations remembers the shards handed out to secrets the cache does not show yet, so
+// concurrent reconciles of Configs and ClusterConfigs do not all pick the same least loaded shard
+type shardReservations struct {
+	mu       sync.Mutex
+	reserved map[types.NamespacedName]shardReservation
+}
+
+type shardReservation struct {
+	shard   int64
+	expires time.Time
+}
+
+var reservedShards = &shardReservations{reserved: map[types.NamespacedName]shardReservation{}}
+
+// assign counts the clusters per shard from the listed secrets of the namespace and the
+// reservations, pick chooses the shard of secret from these loads. The result is reserved for
+// the secret until the cache shows it.
+func (s *shardReservations) assign(secret types.NamespacedName, listed []v1.Secret, shards int, now time.Time, pick func(loads []int) int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loads := make([]int, shards)
+	count := func(shard *int64) {
+		if shard != nil && *shard >= 0 && *shard < int64(shards) {
+			loads[*shard]++
+		}
+	}
+	seen := map[types.NamespacedName]bool{}
+	for i := range listed {
+		key := types.NamespacedName{Namespace: listed[i].Namespace, Name: listed[i].Name}
+		seen[key] = true
+		shard := gardener.SecretShard(&listed[i])
+		if r, ok := s.reserved[key]; ok {
+			if now.After(r.expires) || (shard != nil && *shard == r.shard) {
+				delete(s.reserved, key)
+			} else {
+				shard = &r.shard
+			}
+		}
+		if key != secret {
+			count(shard)
+		}
+	}
+	for key, r := range s.reserved {
+		if now.After(r.expires) {
+			delete(s.reserved, key)
+			continue
+		}
+		if !seen[key] && key != secret && key.Namespace == secret.Namespace {
+			count(&r.shard)
+		}
+	}
+
+	shard := pick(loads)
+	s.reserved[secret] = shardReservation{shard: shard, expires: now.Add(shardReservationTTL)}
+	return shard
+}
+
+// Resync asks the controllers watching the channels to reconcile all their configs again, e.g.
+// after the shard count changed. A resync already pending is enough, so nothing blocks while a
+// replica is not the leader and its controllers do not read the channels.
+func Resync(channels ...chan event.GenericEvent) {
+	for _, ch := range channels {
+		select {
+		case ch <- event.GenericEvent{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"customer.gardener/config/pkg/argocd"
+)
+
+var _ = Describe("Shard reservations", func() {
+	leastLoaded := func(loads []int) int64 { return argocd.LeastLoadedShard(loads, nil) }
+	secret := func(name string, shard int64) v1.Secret {
+		return v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd"},
+			Data:       map[string][]byte{"shard": []byte(fmt.Sprint(shard))},
+		}
+	}
+
+	It("spreads clusters assigned before their secrets reach the cache", func() {
+		s := &shardReservations{reserved: map[types.NamespacedName]shardReservation{}}
+		now := time.Now()
+		listed := []v1.Secret{secret("existing", 0)}
+
+		a := s.assign(types.NamespacedName{Namespace: "argocd", Name: "a"}, listed, 3, now, leastLoaded)
+		b := s.assign(types.NamespacedName{Namespace: "argocd", Name: "b"}, listed, 3, now, leastLoaded)
+		Expect([]int64{a, b}).To(ConsistOf(int64(1), int64(2)))
+
+		// once listed the reservation is dropped, an expired one does not count either
+		listed = append(listed, secret("a", a))
+		s.assign(types.NamespacedName{Namespace: "argocd", Name: "c"}, listed, 3, now.Add(2*shardReservationTTL), leastLoaded)
+		Expect(s.reserved).To(HaveLen(1))
+		Expect(s.reserved).To(HaveKey(types.NamespacedName{Namespace: "argocd", Name: "c"}))
+	})
+
+	It("does not block while nobody reads the resync channel", func() {
+		ch := make(chan event.GenericEvent, 1)
+		Resync(ch)
+		Resync(ch)
+		Expect(ch).To(HaveLen(1))
+	})
+})
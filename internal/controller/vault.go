@@ -0,0 +1,222 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/gardener"
+	"customer.gardener/config/pkg/vault"
+)
+
+// token of the operator service account, used for the Vault kubernetes auth at the Vaults the
+// operator configuration allows
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultLocation returns mount and path of the Vault secret of the config. The path always lies
+// below the namespace of the config, configs share the Vault login of the operator and must not
+// reach the secrets of other namespaces.
+func vaultLocation(config *customergardenerv1.Config) (string, string, error) {
+	mount := config.Spec.Vault.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	path := config.Spec.Vault.Path
+	if path == "" {
+		path = config.Spec.Shoot
+	}
+	if !validVaultPath(mount) || !validVaultPath(path) {
+		return "", "", fmt.Errorf("invalid Vault location %s/%s, absolute paths and . or .. segments are not allowed", mount, path)
+	}
+	return mount, fmt.Sprintf("%s/%s", config.Namespace, path), nil
+}
+
+// validVaultPath refuses absolute paths and segments which leave the namespace prefix
+func validVaultPath(path string) bool {
+	if path == "" || strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// vaultSecretOwned reports whether the recorded Vault secret lies below the namespace of the
+// config, secrets recorded by older operator versions elsewhere are never deleted
+func vaultSecretOwned(config *customergardenerv1.Config, status *customergardenerv1.VaultStatus) bool {
+	return validVaultPath(status.Mount) && validVaultPath(status.Path) &&
+		strings.HasPrefix(status.Path, config.Namespace+"/")
+}
+
+// recordedVault returns the Vault the secret of the status was written to, the vault section
+// of the config is used for statuses without a recorded address
+func recordedVault(config *customergardenerv1.Config, status *customergardenerv1.VaultStatus) *customergardenerv1.VaultOutput {
+	if status.Address == "" || status.Auth == nil {
+		return config.Spec.Vault
+	}
+	return &customergardenerv1.VaultOutput{
+		Address:   status.Address,
+		Namespace: status.Namespace,
+		CABundle:  status.CABundle,
+		Auth:      *status.Auth,
+	}
+}
+
+// vaultClient returns a client for the Vault, authenticated as configured. The service account
+// of the operator is only sent to Vaults and roles allowed by the operator configuration,
+// otherwise every config author could obtain a login of the operator.
+func (r *ConfigReconciler) vaultClient(ctx context.Context, config *customergardenerv1.Config, out *customergardenerv1.VaultOutput) (*vault.Client, error) {
+	if k := out.Auth.Kubernetes; k != nil && out.Auth.TokenSecretRef == nil &&
+		!r.Operator.Get().Vault.AllowsKubernetesLogin(out.Address, k.MountPath, k.Role) {
+		return nil, fmt.Errorf("Vault kubernetes auth at %s with role %s is not allowed by the operator configuration, use a token secret", out.Address, k.Role)
+	}
+	c, err := vault.NewClient(out.Address, out.Namespace, out.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	c.HTTP.Timeout = r.Operator.Get().Timeouts.Vault.Duration
+
+	switch {
+	case out.Auth.TokenSecretRef != nil:
+		secret := &v1.Secret{}
+		ref := out.Auth.TokenSecretRef
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: config.Namespace, Name: ref.Name}, secret); err != nil {
+			return nil, fmt.Errorf("unable to read Vault token secret %s.\n%s -", ref.Name, err)
+		}
+		token, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %s missing in Vault token secret %s", ref.Key, ref.Name)
+		}
+		c.Token = strings.TrimSpace(string(token))
+	case out.Auth.Kubernetes != nil:
+		jwt, err := os.ReadFile(serviceAccountTokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read service account token.\n%s -", err)
+		}
+		mountPath := out.Auth.Kubernetes.MountPath
+		if mountPath == "" {
+			mountPath = "kubernetes"
+		}
+		if err := c.LoginKubernetes(ctx, mountPath, out.Auth.Kubernetes.Role, string(jwt)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("no Vault authentication configured")
+	}
+	return c, nil
+}
+
+// writeVault stores the data of the generated secret as new version in Vault, the
+// secret moves if the configured location changed
+func (r *ConfigReconciler) writeVault(ctx context.Context, config *customergardenerv1.Config, secret *v1.Secret) error {
+	out := config.Spec.Vault
+	mount, path, err := vaultLocation(config)
+	if err != nil {
+		return err
+	}
+	c, err := r.vaultClient(ctx, config, out)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	version, err := c.WriteKV(ctx, mount, path, data)
+	if err != nil {
+		return err
+	}
+	metadata := map[string]string{
+		"config":    fmt.Sprintf("%s/%s", config.Namespace, config.Name),
+		"uid":       string(config.UID),
+		"project":   config.Spec.Project,
+		"shoot":     config.Spec.Shoot,
+		"output":    config.Spec.DesiredOutput,
+		"issued-at": secret.Annotations[gardener.IssuedAtAnnotation],
+	}
+	if err := c.WriteMetadata(ctx, mount, path, metadata); err != nil {
+		return err
+	}
+
+	written := &customergardenerv1.VaultStatus{
+		Mount:     mount,
+		Path:      path,
+		Version:   version,
+		Address:   out.Address,
+		Namespace: out.Namespace,
+		CABundle:  out.CABundle,
+		Auth:      out.Auth.DeepCopy(),
+	}
+	if old := config.Status.Vault; old != nil && !sameVaultSecret(config, old, written) {
+		if err := r.deleteVaultSecret(ctx, config, old); err != nil {
+			return err
+		}
+	}
+	config.Status.Vault = written
+	return nil
+}
+
+// sameVaultSecret reports whether both statuses point to the same secret of the same Vault
+func sameVaultSecret(config *customergardenerv1.Config, old *customergardenerv1.VaultStatus, written *customergardenerv1.VaultStatus) bool {
+	from := recordedVault(config, old)
+	return from != nil && from.Address == written.Address && from.Namespace == written.Namespace &&
+		old.Mount == written.Mount && old.Path == written.Path
+}
+
+// deleteVault removes the Vault secret recorded in the status of the config, also if the
+// vault section is gone already
+func (r *ConfigReconciler) deleteVault(ctx context.Context, config *customergardenerv1.Config) error {
+	if config.Status.Vault == nil {
+		return nil
+	}
+	if err := r.deleteVaultSecret(ctx, config, config.Status.Vault); err != nil {
+		return err
+	}
+	config.Status.Vault = nil
+	return nil
+}
+
+// deleteVaultSecret removes a Vault secret the operator wrote for the config
+func (r *ConfigReconciler) deleteVaultSecret(ctx context.Context, config *customergardenerv1.Config, status *customergardenerv1.VaultStatus) error {
+	reqLogger := log.FromContext(ctx)
+	if !vaultSecretOwned(config, status) {
+		reqLogger.Info(fmt.Sprintf("Keep Vault secret %s/%s, it lies outside of namespace %s", status.Mount, status.Path, config.Namespace))
+		return nil
+	}
+	out := recordedVault(config, status)
+	if out == nil {
+		reqLogger.Info(fmt.Sprintf("Keep Vault secret %s/%s, the Vault it was written to is unknown", status.Mount, status.Path))
+		return nil
+	}
+	c, err := r.vaultClient(ctx, config, out)
+	if err != nil {
+		return err
+	}
+	return c.DeleteKV(ctx, status.Mount, status.Path)
+}
@@ -0,0 +1,359 @@
+package argocd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// APIClient talks to the REST API of a remote ArgoCD instance
+type APIClient struct {
+	Server string
+	Token  string
+	HTTP   *http.Client
+}
+
+// NewAPIClient returns a client for the ArgoCD at server, caBundle is an optional PEM encoded CA
+func NewAPIClient(server string, token string, caBundle string) (*APIClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, fmt.Errorf("no certificate found in the ArgoCD CA bundle")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &APIClient{
+		Server: strings.TrimSuffix(server, "/"),
+		Token:  token,
+		HTTP:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Cluster is the cluster resource of the ArgoCD API, the same content as a cluster secret
+type Cluster struct {
+	Server           string            `json:"server"`
+	Name             string            `json:"name"`
+	Config           json.RawMessage   `json:"config"`
+	Namespaces       []string          `json:"namespaces,omitempty"`
+	ClusterResources bool              `json:"clusterResources,omitempty"`
+	Project          string            `json:"project,omitempty"`
+	Shard            *int64            `json:"shard,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Annotations      map[string]string `json:"annotations,omitempty"`
+}
+
+// ClusterFromSecret converts a generated ArgoCD cluster secret into the API representation,
+// the ArgoCD secret type label and the annotations of the operator are left out
+func ClusterFromSecret(secret *v1.Secret) (*Cluster, error) {
+	cluster := &Cluster{
+		Server:  string(secret.Data["server"]),
+		Name:    string(secret.Data["name"]),
+		Config:  json.RawMessage(secret.Data["config"]),
+		Project: string(secret.Data["project"]),
+	}
+	if cluster.Server == "" {
+		return nil, fmt.Errorf("secret %s has no server", secret.Name)
+	}
+	if namespaces := string(secret.Data["namespaces"]); namespaces != "" {
+		cluster.Namespaces = strings.Split(namespaces, ",")
+	}
+	cluster.ClusterResources = string(secret.Data["clusterResources"]) == "true"
+	if value, ok := secret.Data["shard"]; ok {
+		shard, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shard %q in secret %s", value, secret.Name)
+		}
+		cluster.Shard = &shard
+	}
+	for k, v := range secret.Labels {
+		if k == "argocd.argoproj.io/secret-type" {
+			continue
+		}
+		if cluster.Labels == nil {
+			cluster.Labels = map[string]string{}
+		}
+		cluster.Labels[k] = v
+	}
+	for k, v := range secret.Annotations {
+		if strings.HasPrefix(k, "configs.customer.gardener/") {
+			continue
+		}
+		if cluster.Annotations == nil {
+			cluster.Annotations = map[string]string{}
+		}
+		cluster.Annotations[k] = v
+	}
+	return cluster, nil
+}
+
+// UpsertCluster registers the cluster or replaces the registration with the same server
+func (c *APIClient) UpsertCluster(ctx context.Context, cluster *Cluster) error {
+	if err := c.do(ctx, http.MethodPost, "clusters?upsert=true", cluster, nil); err != nil {
+		return fmt.Errorf("unable to register cluster %s at ArgoCD.\n%s -", cluster.Server, err)
+	}
+	return nil
+}
+
+// DeleteCluster removes the cluster registered with server, a missing cluster is no error
+func (c *APIClient) DeleteCluster(ctx context.Context, server string) error {
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("clusters/%s", url.PathEscape(server)), nil, nil)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to remove cluster %s from ArgoCD.\n%s -", server, err)
+	}
+	return nil
+}
+
+// UpsertProject creates the project or replaces the one with the same name
+func (c *APIClient) UpsertProject(ctx context.Context, project ArgoProject) error {
+	if err := c.createProject(ctx, project, true); err != nil {
+		return fmt.Errorf("unable to create project %s at ArgoCD.\n%s -", project.Metadata.Name, err)
+	}
+	return nil
+}
+
+// createProject creates the project, without upsert an existing project is refused with a conflict
+func (c *APIClient) createProject(ctx context.Context, project ArgoProject, upsert bool) error {
+	body := map[string]interface{}{
+		"project": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":        project.Metadata.Name,
+				"labels":      project.Metadata.Labels,
+				"annotations": project.Metadata.Annotations,
+			},
+			"spec": project.Spec,
+		},
+		"upsert": upsert,
+	}
+	return c.do(ctx, http.MethodPost, "projects", body, nil)
+}
+
+// ApplyProject creates the project of the input or merges the parts the config owns into the
+// existing one like MergeProject does
+func (c *APIClient) ApplyProject(ctx context.Context, input *Input, api string) error {
+	desired, err := ConfigProject(input.S, "", api)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < projectUpdateAttempts; attempt++ {
+		found, err := c.modifyProject(ctx, desired.Metadata.Name, func(existing *unstructured.Unstructured) error {
+			return MergeProject(existing, desired, input)
+		})
+		if err != nil || found {
+			return err
+		}
+		// never replace a project another config created in between, merge into it on the next attempt
+		err = c.createProject(ctx, desired, false)
+		if IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to create project %s at ArgoCD.\n%s -", desired.Metadata.Name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unable to create project %s at ArgoCD, it was created and deleted concurrently", desired.Metadata.Name)
+}
+
+// ReleaseProject removes what a config added to a project other configs still use
+func (c *APIClient) ReleaseProject(ctx context.Context, name string, servers []string, roles []string) error {
+	_, err := c.modifyProject(ctx, name, func(existing *unstructured.Unstructured) error {
+		return RemoveFromProject(existing, servers, roles)
+	})
+	return err
+}
+
+// attempts to write a project other configs change at the same time
+const projectUpdateAttempts = 5
+
+// modifyProject reads the project, applies modify and writes it back with the read
+// resourceVersion. A project changed in between is read and modified again, so concurrent
+// configs never drop each other's destinations and roles. It reports false if the project
+// does not exist.
+func (c *APIClient) modifyProject(ctx context.Context, name string, modify func(*unstructured.Unstructured) error) (bool, error) {
+	var err error
+	for attempt := 0; attempt < projectUpdateAttempts; attempt++ {
+		existing := &unstructured.Unstructured{}
+		err = c.do(ctx, http.MethodGet, fmt.Sprintf("projects/%s", url.PathEscape(name)), nil, &existing.Object)
+		if IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return true, fmt.Errorf("unable to read project %s at ArgoCD.\n%s -", name, err)
+		}
+		if err := modify(existing); err != nil {
+			return true, err
+		}
+		body := map[string]interface{}{"project": existing.Object}
+		err = c.do(ctx, http.MethodPut, fmt.Sprintf("projects/%s", url.PathEscape(name)), body, nil)
+		if !IsConflict(err) {
+			break
+		}
+	}
+	if err != nil {
+		return true, fmt.Errorf("unable to update project %s at ArgoCD.\n%s -", name, err)
+	}
+	return true, nil
+}
+
+// IssueRoleToken issues a JWT token for the role of the project, expiresIn is in seconds and
+// 0 for a token without expiry
+func (c *APIClient) IssueRoleToken(ctx context.Context, project string, role string, id string, expiresIn int64) (string, error) {
+	body := map[string]interface{}{"id": id, "expiresIn": expiresIn}
+	resp := struct {
+		Token string `json:"token"`
+	}{}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("projects/%s/roles/%s/token", url.PathEscape(project), url.PathEscape(role)), body, &resp); err != nil {
+		return "", fmt.Errorf("unable to issue token for role %s of project %s.\n%s -", role, project, err)
+	}
+	if resp.Token == "" {
+		return "", fmt.Errorf("argocd returned no token for role %s of project %s", role, project)
+	}
+	return resp.Token, nil
+}
+
+// DeleteRoleToken removes the token of the role issued at iat, a missing token is no error
+func (c *APIClient) DeleteRoleToken(ctx context.Context, project string, role string, iat int64) error {
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("projects/%s/roles/%s/token/%d", url.PathEscape(project), url.PathEscape(role), iat), nil, nil)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to delete token of role %s of project %s.\n%s -", role, project, err)
+	}
+	return nil
+}
+
+// TokenIssuedAt returns the iat claim of a JWT token without verifying it
+func TokenIssuedAt(token string) (int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("token is no JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	claims := struct {
+		IssuedAt int64 `json:"iat"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return 0, err
+	}
+	return claims.IssuedAt, nil
+}
+
+// DeleteProject removes the project, a missing project is no error
+func (c *APIClient) DeleteProject(ctx context.Context, name string) error {
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("projects/%s", url.PathEscape(name)), nil, nil)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to delete project %s at ArgoCD.\n%s -", name, err)
+	}
+	return nil
+}
+
+// UpsertApplication creates the Application or replaces the one with the same name
+func (c *APIClient) UpsertApplication(ctx context.Context, app Application) error {
+	app.Metadata.Namespace = ""
+	if err := c.do(ctx, http.MethodPost, "applications?upsert=true", app, nil); err != nil {
+		return fmt.Errorf("unable to create application %s at ArgoCD.\n%s -", app.Metadata.Name, err)
+	}
+	return nil
+}
+
+// GetApplication reads the Application, nil if it does not exist
+func (c *APIClient) GetApplication(ctx context.Context, name string) (*Application, error) {
+	app := &Application{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("applications/%s", url.PathEscape(name)), nil, app)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read application %s at ArgoCD.\n%s -", name, err)
+	}
+	return app, nil
+}
+
+// DeleteApplication removes the Application without its resources on the cluster, a missing
+// Application is no error
+func (c *APIClient) DeleteApplication(ctx context.Context, name string) error {
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("applications/%s?cascade=false", url.PathEscape(name)), nil, nil)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to delete application %s at ArgoCD.\n%s -", name, err)
+	}
+	return nil
+}
+
+// ResponseError is returned for non successful ArgoCD responses
+type ResponseError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("argocd responded %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether ArgoCD answered with 404
+func IsNotFound(err error) bool {
+	respErr, ok := err.(*ResponseError)
+	return ok && respErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether ArgoCD refused an update of an object changed in between
+func IsConflict(err error) bool {
+	respErr, ok := err.(*ResponseError)
+	return ok && respErr.StatusCode == http.StatusConflict
+}
+
+func (c *APIClient) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/api/v1/%s", c.Server, path), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respErr := &ResponseError{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(content, respErr)
+		return respErr
+	}
+	if out != nil && len(content) > 0 {
+		return json.Unmarshal(content, out)
+	}
+	return nil
+}
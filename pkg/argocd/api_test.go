@@ -0,0 +1,387 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package argocd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+// fakeArgoCD keeps clusters and projects like the ArgoCD API does
+type fakeArgoCD struct {
+	sync.Mutex
+	token    string
+	clusters map[string]Cluster
+	projects map[string]map[string]interface{}
+	apps     map[string]Application
+	issued   int64
+	version  int64
+	// beforeUpdate runs once before the next project update, like a concurrent writer
+	beforeUpdate func()
+	// beforeCreate runs once before the next project creation, like a concurrent writer
+	beforeCreate func()
+}
+
+// storeProject saves the project with a new resourceVersion
+func (f *fakeArgoCD) storeProject(name string, project map[string]interface{}) {
+	f.version++
+	project["metadata"].(map[string]interface{})["resourceVersion"] = fmt.Sprint(f.version)
+	f.projects[name] = project
+}
+
+func (f *fakeArgoCD) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if req.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.EscapedPath(), "/api/v1/")
+	switch {
+	case req.Method == http.MethodPost && path == "clusters":
+		cluster := Cluster{}
+		if err := json.NewDecoder(req.Body).Decode(&cluster); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, ok := f.clusters[cluster.Server]; ok && req.URL.Query().Get("upsert") != "true" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.clusters[cluster.Server] = cluster
+	case req.Method == http.MethodDelete && strings.HasPrefix(path, "clusters/"):
+		server, _ := strings.CutPrefix(req.URL.Path, "/api/v1/clusters/")
+		if _, ok := f.clusters[server]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"cluster not found"}`))
+			return
+		}
+		delete(f.clusters, server)
+	case req.Method == http.MethodPost && path == "projects":
+		body := struct {
+			Project map[string]interface{} `json:"project"`
+			Upsert  bool                   `json:"upsert"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if f.beforeCreate != nil {
+			f.beforeCreate()
+			f.beforeCreate = nil
+		}
+		name := body.Project["metadata"].(map[string]interface{})["name"].(string)
+		if _, ok := f.projects[name]; ok && !body.Upsert {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.storeProject(name, body.Project)
+	case req.Method == http.MethodPut && strings.HasPrefix(path, "projects/"):
+		body := struct {
+			Project map[string]interface{} `json:"project"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if f.beforeUpdate != nil {
+			f.beforeUpdate()
+			f.beforeUpdate = nil
+		}
+		name := strings.TrimPrefix(path, "projects/")
+		existing, ok := f.projects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		current := existing["metadata"].(map[string]interface{})["resourceVersion"]
+		if body.Project["metadata"].(map[string]interface{})["resourceVersion"] != current {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"message":"the object has been modified"}`))
+			return
+		}
+		f.storeProject(name, body.Project)
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "projects/"):
+		project, ok := f.projects[strings.TrimPrefix(path, "projects/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(project)
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/token"):
+		// projects/<project>/roles/<role>/token
+		parts := strings.Split(path, "/")
+		project, ok := f.projects[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.issued++
+		for _, role := range project["spec"].(map[string]interface{})["roles"].([]interface{}) {
+			role := role.(map[string]interface{})
+			if role["name"] == parts[3] {
+				tokens, _ := role["jwtTokens"].([]interface{})
+				role["jwtTokens"] = append(tokens, map[string]interface{}{"iat": f.issued})
+			}
+		}
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, f.issued)))
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "e30." + claims + ".sig"})
+	case req.Method == http.MethodPost && path == "applications":
+		app := Application{}
+		if err := json.NewDecoder(req.Body).Decode(&app); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.apps[app.Metadata.Name] = app
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "applications/"):
+		app, ok := f.apps[strings.TrimPrefix(path, "applications/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(app)
+	case req.Method == http.MethodDelete && strings.HasPrefix(path, "projects/"):
+		name := strings.TrimPrefix(path, "projects/")
+		if _, ok := f.projects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.projects, name)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+var _ = Describe("APIClient", func() {
+	ctx := context.Background()
+	var fake *fakeArgoCD
+	var server *httptest.Server
+	var c *APIClient
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "shoot-abc123",
+			Labels: map[string]string{
+				"argocd.argoproj.io/secret-type": "cluster",
+				"stage":                          "prod",
+			},
+			Annotations: map[string]string{
+				"configs.customer.gardener/content-hash": "1234",
+				"team":                                   "platform",
+			},
+		},
+		Data: map[string][]byte{
+			"name":       []byte("shoot-abc123"),
+			"server":     []byte("https://api.shoot.example.com"),
+			"config":     []byte(`{"tlsClientConfig":{"caData":"Y2E=","certData":"Y2VydA==","keyData":"a2V5"}}`),
+			"namespaces": []byte("app,monitoring"),
+			"shard":      []byte("2"),
+		},
+	}
+
+	BeforeEach(func() {
+		fake = &fakeArgoCD{token: "secret-token", clusters: map[string]Cluster{}, projects: map[string]map[string]interface{}{}, apps: map[string]Application{}}
+		server = httptest.NewServer(fake)
+		var err error
+		c, err = NewAPIClient(server.URL+"/", "secret-token", "")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("converts a cluster secret", func() {
+		cluster, err := ClusterFromSecret(secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Server).To(Equal("https://api.shoot.example.com"))
+		Expect(cluster.Namespaces).To(Equal([]string{"app", "monitoring"}))
+		Expect(*cluster.Shard).To(Equal(int64(2)))
+		Expect(cluster.Labels).To(Equal(map[string]string{"stage": "prod"}))
+		Expect(cluster.Annotations).To(Equal(map[string]string{"team": "platform"}))
+		Expect(string(cluster.Config)).To(ContainSubstring(`"certData":"Y2VydA=="`))
+	})
+
+	It("registers, updates and removes a cluster", func() {
+		cluster, err := ClusterFromSecret(secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.UpsertCluster(ctx, cluster)).To(Succeed())
+		Expect(fake.clusters).To(HaveKey("https://api.shoot.example.com"))
+
+		cluster.Config = json.RawMessage(`{"tlsClientConfig":{"caData":"Y2E=","certData":"bmV3","keyData":"bmV3"}}`)
+		Expect(c.UpsertCluster(ctx, cluster)).To(Succeed())
+		Expect(string(fake.clusters["https://api.shoot.example.com"].Config)).To(ContainSubstring(`"certData":"bmV3"`))
+
+		Expect(c.DeleteCluster(ctx, "https://api.shoot.example.com")).To(Succeed())
+		Expect(fake.clusters).To(BeEmpty())
+		Expect(c.DeleteCluster(ctx, "https://api.shoot.example.com")).To(Succeed())
+	})
+
+	It("creates and deletes a project", func() {
+		Expect(c.UpsertProject(ctx, ArgoCDProject("abc", "", "https://api.shoot.example.com"))).To(Succeed())
+		Expect(fake.projects["abc"]).To(HaveKey("spec"))
+
+		Expect(c.DeleteProject(ctx, "abc")).To(Succeed())
+		Expect(fake.projects).To(BeEmpty())
+		Expect(c.DeleteProject(ctx, "abc")).To(Succeed())
+	})
+
+	configFor := func(shoot string, roles ...customergardenerv1.ProjectRole) *customergardenerv1.Config {
+		return &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{Name: shoot},
+			Spec: customergardenerv1.ConfigSpec{
+				DesiredOutput: "ArgoCD",
+				Shoot:         shoot,
+				AppProject:    &customergardenerv1.AppProjectSpec{Name: "abc", Roles: roles},
+			},
+		}
+	}
+	appliedProject := func() ArgoProject {
+		project := ArgoProject{}
+		body, _ := json.Marshal(fake.projects["abc"])
+		Expect(json.Unmarshal(body, &project)).To(Succeed())
+		return project
+	}
+
+	It("keeps issued role tokens when applying a project", func() {
+		Expect(c.ApplyProject(ctx, &Input{S: configFor("shoot-abc1")}, "https://api.dev.example.com")).To(Succeed())
+		token, err := c.IssueRoleToken(ctx, "abc", "default", "ci", 3600)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(TokenIssuedAt(token)).To(Equal(int64(1)))
+
+		config := configFor("shoot-abc1", customergardenerv1.ProjectRole{Name: "default", Groups: []string{"team-abc"}})
+		Expect(c.ApplyProject(ctx, &Input{S: config}, "https://api.dev.example.com")).To(Succeed())
+
+		project := appliedProject()
+		Expect(project.Spec.Roles).To(HaveLen(1))
+		Expect(project.Spec.Roles[0].Groups).To(Equal([]string{"team-abc"}))
+		Expect(project.Spec.Roles[0].JWTTokens).To(ConsistOf(JWTToken{IssuedAt: 1}))
+	})
+
+	It("shares a project between configs", func() {
+		dev := configFor("shoot-abc1", customergardenerv1.ProjectRole{Name: "developers"})
+		prod := configFor("shoot-abc2", customergardenerv1.ProjectRole{Name: "operators"})
+		Expect(c.ApplyProject(ctx, &Input{S: dev}, "https://api.dev.example.com")).To(Succeed())
+		Expect(c.ApplyProject(ctx, &Input{S: prod}, "https://api.prod.example.com")).To(Succeed())
+
+		project := appliedProject()
+		Expect(project.Spec.Destinations).To(HaveLen(2))
+		Expect(project.Spec.Roles).To(HaveLen(2))
+
+		// the dev shoot moved to another API server and dropped its role
+		dev.Spec.AppProject.Roles = []customergardenerv1.ProjectRole{{Name: "maintainers"}}
+		Expect(c.ApplyProject(ctx, &Input{S: dev, StaleServers: []string{"https://api.dev.example.com"}, StaleRoles: []string{"developers"}},
+			"https://api.dev2.example.com")).To(Succeed())
+		project = appliedProject()
+		Expect(project.Spec.Destinations).To(ConsistOf(
+			HaveField("Server", "https://api.prod.example.com"),
+			HaveField("Server", "https://api.dev2.example.com")))
+		Expect(project.Spec.Roles).To(ConsistOf(HaveField("Name", "operators"), HaveField("Name", "maintainers")))
+
+		Expect(c.ReleaseProject(ctx, "abc", []string{"https://api.dev2.example.com"}, []string{"maintainers"})).To(Succeed())
+		project = appliedProject()
+		Expect(project.Spec.Destinations).To(ConsistOf(HaveField("Server", "https://api.prod.example.com")))
+		Expect(project.Spec.Roles).To(ConsistOf(HaveField("Name", "operators")))
+	})
+
+	It("keeps the destination of a config updating the project at the same time", func() {
+		Expect(c.ApplyProject(ctx, &Input{S: configFor("shoot-abc1")}, "https://api.dev.example.com")).To(Succeed())
+		prod := configFor("shoot-abc2")
+
+		// another config adds its destination between our read and write
+		fake.beforeUpdate = func() {
+			project := fake.projects["abc"]
+			spec := project["spec"].(map[string]interface{})
+			spec["destinations"] = append(spec["destinations"].([]interface{}),
+				map[string]interface{}{"server": "https://api.qa.example.com", "namespace": "*"})
+			fake.storeProject("abc", project)
+		}
+		Expect(c.ApplyProject(ctx, &Input{S: prod}, "https://api.prod.example.com")).To(Succeed())
+		Expect(fake.beforeUpdate).To(BeNil())
+
+		project := appliedProject()
+		Expect(project.Spec.Destinations).To(ConsistOf(
+			HaveField("Server", "https://api.dev.example.com"),
+			HaveField("Server", "https://api.qa.example.com"),
+			HaveField("Server", "https://api.prod.example.com")))
+	})
+
+	It("merges into a project another config created between the read and the create", func() {
+		dev := configFor("shoot-abc1", customergardenerv1.ProjectRole{Name: "developers"})
+		prod := configFor("shoot-abc2", customergardenerv1.ProjectRole{Name: "operators"})
+
+		// the dev config creates the project after our read found none
+		fake.beforeCreate = func() {
+			created, err := ConfigProject(dev, "", "https://api.dev.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			body, _ := json.Marshal(created)
+			project := map[string]interface{}{}
+			Expect(json.Unmarshal(body, &project)).To(Succeed())
+			fake.storeProject("abc", project)
+		}
+		Expect(c.ApplyProject(ctx, &Input{S: prod}, "https://api.prod.example.com")).To(Succeed())
+		Expect(fake.beforeCreate).To(BeNil())
+
+		project := appliedProject()
+		Expect(project.Spec.Destinations).To(ConsistOf(
+			HaveField("Server", "https://api.dev.example.com"),
+			HaveField("Server", "https://api.prod.example.com")))
+		Expect(project.Spec.Roles).To(ConsistOf(HaveField("Name", "developers"), HaveField("Name", "operators")))
+	})
+
+	It("refuses to change a foreign project", func() {
+		project := ArgoCDProject("abc", "", "https://api.shoot.example.com")
+		project.Metadata.Labels = nil
+		Expect(c.UpsertProject(ctx, project)).To(Succeed())
+
+		Expect(c.ApplyProject(ctx, &Input{S: configFor("shoot-abc1")}, "https://api.shoot.example.com")).NotTo(Succeed())
+		Expect(c.ApplyProject(ctx, &Input{S: configFor("shoot-abc1"), Owned: true}, "https://api.shoot.example.com")).To(Succeed())
+	})
+
+	It("reads the live Application", func() {
+		app := Application{Metadata: Metadata{Name: "shoot-bootstrap"}, Spec: ApplicationSpec{Project: "abc"}}
+		Expect(c.UpsertApplication(ctx, app)).To(Succeed())
+		live, err := c.GetApplication(ctx, "shoot-bootstrap")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(live.Spec).To(Equal(app.Spec))
+
+		live, err = c.GetApplication(ctx, "missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(live).To(BeNil())
+	})
+
+	It("fails with a wrong token", func() {
+		c.Token = "wrong"
+		err := c.DeleteProject(ctx, "abc")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("401"))
+	})
+})
@@ -0,0 +1,173 @@
+package argocd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ApplicationGVK identifies the ArgoCD Application
+var ApplicationGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Application"}
+
+type Application struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   Metadata        `json:"metadata"`
+	Spec       ApplicationSpec `json:"spec"`
+}
+
+type ApplicationSpec struct {
+	Project     string            `json:"project"`
+	Source      ApplicationSource `json:"source"`
+	Destination Destinations      `json:"destination"`
+	SyncPolicy  *SyncPolicy       `json:"syncPolicy,omitempty"`
+}
+
+type ApplicationSource struct {
+	RepoURL        string `json:"repoURL"`
+	Path           string `json:"path,omitempty"`
+	TargetRevision string `json:"targetRevision,omitempty"`
+}
+
+type SyncPolicy struct {
+	Automated   *SyncPolicyAutomated `json:"automated,omitempty"`
+	SyncOptions []string             `json:"syncOptions,omitempty"`
+}
+
+type SyncPolicyAutomated struct {
+	Prune    bool `json:"prune"`
+	SelfHeal bool `json:"selfHeal"`
+}
+
+// ApplicationName returns the name of the bootstrap Application of a config
+func ApplicationName(s *customergardenerv1.Config) string {
+	if s.Spec.Bootstrap != nil && s.Spec.Bootstrap.Name != "" {
+		return s.Spec.Bootstrap.Name
+	}
+	return fmt.Sprintf("%s-bootstrap", s.Spec.Shoot)
+}
+
+// BootstrapApplication renders the bootstrap Application of the config into the project,
+// deploying to the shoot behind server
+func BootstrapApplication(s *customergardenerv1.Config, project string, namespace string, server string) Application {
+	b := s.Spec.Bootstrap
+	revision := b.TargetRevision
+	if revision == "" {
+		revision = "HEAD"
+	}
+	app := Application{
+		APIVersion: "argoproj.io/v1alpha1",
+		Kind:       "Application",
+		Metadata: Metadata{
+			Annotations: map[string]string{},
+			Labels: map[string]string{
+				customergardenerv1.ManagedByLabel: customergardenerv1.ManagedByValue,
+			},
+			Name:      ApplicationName(s),
+			Namespace: namespace,
+		},
+		Spec: ApplicationSpec{
+			Project: project,
+			Source: ApplicationSource{
+				RepoURL:        b.RepoURL,
+				Path:           b.Path,
+				TargetRevision: revision,
+			},
+			Destination: Destinations{
+				Namespace: b.Namespace,
+				Server:    server,
+			},
+			SyncPolicy: &SyncPolicy{SyncOptions: []string{"CreateNamespace=true"}},
+		},
+	}
+	if b.Automated {
+		app.Spec.SyncPolicy.Automated = &SyncPolicyAutomated{Prune: true, SelfHeal: true}
+	}
+	return app
+}
+
+// Hash identifies the rendered content of an ArgoCD object
+func Hash(object interface{}) (string, error) {
+	body, err := json.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ApplicationCurrent reports whether the live Application is managed by the operator and still
+// has the rendered spec, a deleted or edited Application has to be applied again
+func ApplicationCurrent(live *Application, desired Application) bool {
+	return live != nil && live.Metadata.Labels[customergardenerv1.ManagedByLabel] == customergardenerv1.ManagedByValue &&
+		reflect.DeepEqual(live.Spec, desired.Spec)
+}
+
+// GetApplication reads the Application, nil if it does not exist
+func GetApplication(ctx context.Context, c client.Client, namespace string, name string) (*Application, error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(ApplicationGVK)
+	err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, existing)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Application %s/%s\n%s -", namespace, name, err)
+	}
+	app := &Application{}
+	if err := fromUnstructured(existing, app); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// ApplyApplication creates the Application or updates the spec of an existing one managed by
+// the operator, a foreign Application with the same name is left alone
+func ApplyApplication(ctx context.Context, c client.Client, app Application) error {
+	desired, err := toUnstructured(app)
+	if err != nil {
+		return err
+	}
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(ApplicationGVK)
+	err = c.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if errors.IsNotFound(err) {
+		if err := c.Create(ctx, desired); err != nil {
+			return fmt.Errorf("unable to create Application %s/%s\n%s -", app.Metadata.Namespace, app.Metadata.Name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.GetLabels()[customergardenerv1.ManagedByLabel] != customergardenerv1.ManagedByValue {
+		return fmt.Errorf("Application %s/%s already exists and is not managed by the operator", app.Metadata.Namespace, app.Metadata.Name)
+	}
+	existing.Object["spec"] = desired.Object["spec"]
+	if err := c.Update(ctx, existing); err != nil {
+		return fmt.Errorf("unable to update Application %s/%s\n%s -", app.Metadata.Namespace, app.Metadata.Name, err)
+	}
+	return nil
+}
+
+// DeleteApplication removes the Application without its resources on the shoot, an Application
+// which is already gone is no error
+func DeleteApplication(ctx context.Context, c client.Client, namespace string, name string) error {
+	app := &unstructured.Unstructured{}
+	app.SetGroupVersionKind(ApplicationGVK)
+	app.SetNamespace(namespace)
+	app.SetName(name)
+	if err := c.Delete(ctx, app); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete Application %s/%s\n%s -", namespace, name, err)
+	}
+	return nil
+}
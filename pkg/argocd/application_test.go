@@ -0,0 +1,71 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package argocd
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+var _ = Describe("BootstrapApplication", func() {
+	config := &customergardenerv1.Config{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "shoot"},
+		Spec: customergardenerv1.ConfigSpec{
+			DesiredOutput: "ArgoCD",
+			Shoot:         "shoot-abc123",
+			Bootstrap: &customergardenerv1.Bootstrap{
+				RepoURL:   "https://git.example.com/baseline.git",
+				Path:      "clusters/base",
+				Automated: true,
+			},
+		},
+	}
+
+	It("deploys the repository to the shoot within the project", func() {
+		app := BootstrapApplication(config, "abc", "argocd", "https://api.shoot.example.com")
+		Expect(app.Metadata.Name).To(Equal("shoot-abc123-bootstrap"))
+		Expect(app.Spec.Project).To(Equal("abc"))
+		Expect(app.Spec.Source.TargetRevision).To(Equal("HEAD"))
+		Expect(app.Spec.Destination.Server).To(Equal("https://api.shoot.example.com"))
+		Expect(app.Spec.SyncPolicy.Automated).NotTo(BeNil())
+	})
+
+	It("changes the hash with the source", func() {
+		before, err := Hash(BootstrapApplication(config, "abc", "argocd", "https://api.shoot.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		changed := config.DeepCopy()
+		changed.Spec.Bootstrap.TargetRevision = "v2"
+		after, err := Hash(BootstrapApplication(changed, "abc", "argocd", "https://api.shoot.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).NotTo(Equal(before))
+	})
+
+	It("applies a deleted or edited Application again", func() {
+		app := BootstrapApplication(config, "abc", "argocd", "https://api.shoot.example.com")
+		Expect(ApplicationCurrent(nil, app)).To(BeFalse())
+
+		live := BootstrapApplication(config, "abc", "argocd", "https://api.shoot.example.com")
+		Expect(ApplicationCurrent(&live, app)).To(BeTrue())
+
+		live.Spec.Source.TargetRevision = "main"
+		Expect(ApplicationCurrent(&live, app)).To(BeFalse())
+	})
+})
@@ -7,8 +7,10 @@ import (
 	"strings"
 
 	customergardenerv1 "customer.gardener/config/api/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type ArgoProject struct {
@@ -20,6 +22,7 @@ type ArgoProject struct {
 
 type Metadata struct {
 	Annotations map[string]string `json:"annotations"`
+	Labels      map[string]string `json:"labels,omitempty"`
 	Name        string            `json:"name"`
 	Namespace   string            `json:"namespace"`
 }
@@ -39,8 +42,18 @@ type NamespaceResourceWhitelist struct {
 }
 
 type Roles struct {
-	Name     string   `json:"name"`
-	Policies []string `json:"policies"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Policies    []string   `json:"policies"`
+	Groups      []string   `json:"groups,omitempty"`
+	JWTTokens   []JWTToken `json:"jwtTokens,omitempty"`
+}
+
+// JWTToken is a token ArgoCD issued for a role
+type JWTToken struct {
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	ID        string `json:"id,omitempty"`
 }
 type Spec struct {
 	ClusterResourceWhitelist   []ClusterResourceWhitelist   `json:"clusterResourceWhitelist"`
@@ -49,53 +62,302 @@ type Spec struct {
 	NamespaceResourceWhitelist []NamespaceResourceWhitelist `json:"namespaceResourceWhitelist"`
 	Roles                      []Roles                      `json:"roles"`
 	SourceRepos                []string                     `json:"sourceRepos"`
+	SyncWindows                []SyncWindow                 `json:"syncWindows,omitempty"`
 }
 
 type Input struct {
 	S *customergardenerv1.Config
+	// the project was created for the config before, it is adopted even without the managed-by label
+	Owned bool
+	// destination servers and roles the config added before and no other config wants anymore
+	StaleServers []string
+	StaleRoles   []string
 }
 
-func DeleteProject(namespace string, projectName string) {
-	// creates the in-cluster config
-	config, err := rest.InClusterConfig()
+// ProjectName returns the name of the AppProject of a config, the customer id within the shoot
+// name unless the config names the project
+func ProjectName(s *customergardenerv1.Config) (string, error) {
+	if s.Spec.AppProject != nil && s.Spec.AppProject.Name != "" {
+		return s.Spec.AppProject.Name, nil
+	}
+	parts := strings.Split(s.Spec.Shoot, "-")
+	if len(parts) < 2 || len(parts[1]) < 3 {
+		return "", fmt.Errorf("shoot name %s holds no customer id, set spec.appProject.name", s.Spec.Shoot)
+	}
+	return parts[1][0:3], nil
+}
+
+// AppProjectGVK identifies the ArgoCD AppProject, handled as unstructured object so the
+// operator does not depend on the ArgoCD types
+var AppProjectGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "AppProject"}
+
+// DeleteProject removes the AppProject, a project which is already gone is no error
+func DeleteProject(ctx context.Context, c client.Client, namespace string, projectName string) error {
+	project := &unstructured.Unstructured{}
+	project.SetGroupVersionKind(AppProjectGVK)
+	project.SetNamespace(namespace)
+	project.SetName(projectName)
+	if err := c.Delete(ctx, project); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete AppProject %s/%s\n%s -", namespace, projectName, err)
+	}
+	return nil
+}
+
+// CreateProject creates the AppProject of the config or brings the parts the operator owns in
+// an existing one up to date, a foreign project is never changed
+func CreateProject(ctx context.Context, c client.Client, input *Input, api string) error {
+	desired, err := ConfigProject(input.S, input.S.ObjectMeta.Namespace, api)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	clientset, err := kubernetes.NewForConfig(config)
+	project, err := toUnstructured(desired)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	clientset.RESTClient().
-		Delete().
-		AbsPath(fmt.Sprintf("apis/argoproj.io/v1alpha1/namespaces/%s/appprojects/%s", namespace, projectName)).
-		DoRaw(context.TODO())
 
+	err = c.Create(ctx, project)
+	if errors.IsAlreadyExists(err) {
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(AppProjectGVK)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(project), existing); err != nil {
+			return err
+		}
+		if err := MergeProject(existing, desired, input); err != nil {
+			return err
+		}
+		if err := c.Update(ctx, existing); err != nil {
+			return fmt.Errorf("unable to update AppProject %s/%s\n%s -", existing.GetNamespace(), existing.GetName(), err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create AppProject %s/%s\n%s -", desired.Metadata.Namespace, desired.Metadata.Name, err)
+	}
+	return nil
 }
 
-func CreateProject(input *Input, api string) error {
-	cid := strings.Split(input.S.Spec.Shoot, "-")[1][0:3]
-	project := ArgoCDProject(cid, input.S.ObjectMeta.Namespace, api)
+// MergeProject brings the parts of an existing project a config owns in line with the desired
+// project, other configs sharing the project are left alone: the roles of the config are
+// replaced keeping the tokens ArgoCD issued for them, its destinations are added and the
+// stale ones of the input removed, the sync windows of its servers are replaced. A project
+// without the managed-by label is refused unless the input owns it.
+func MergeProject(existing *unstructured.Unstructured, desired ArgoProject, input *Input) error {
+	labels := existing.GetLabels()
+	if labels[customergardenerv1.ManagedByLabel] != customergardenerv1.ManagedByValue {
+		if !input.Owned {
+			return fmt.Errorf("AppProject %s/%s already exists and is not managed by the operator", existing.GetNamespace(), existing.GetName())
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[customergardenerv1.ManagedByLabel] = customergardenerv1.ManagedByValue
+		existing.SetLabels(labels)
+	}
+
+	current := ArgoProject{}
+	if err := fromUnstructured(existing, &current); err != nil {
+		return err
+	}
+	current.Spec.Destinations = removeDestinations(current.Spec.Destinations, input.StaleServers)
+	current.Spec.Roles = removeRoles(current.Spec.Roles, input.StaleRoles)
 
-	json, err := json.Marshal(project)
+	for _, role := range desired.Spec.Roles {
+		found := false
+		for i := range current.Spec.Roles {
+			if current.Spec.Roles[i].Name == role.Name {
+				role.JWTTokens = current.Spec.Roles[i].JWTTokens
+				current.Spec.Roles[i] = role
+				found = true
+				break
+			}
+		}
+		if !found {
+			current.Spec.Roles = append(current.Spec.Roles, role)
+		}
+	}
+
+	for _, d := range desired.Spec.Destinations {
+		found := false
+		for _, e := range current.Spec.Destinations {
+			if e.Server == d.Server && e.Namespace == d.Namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			current.Spec.Destinations = append(current.Spec.Destinations, d)
+		}
+	}
+
+	servers := append([]string{}, input.StaleServers...)
+	for _, d := range desired.Spec.Destinations {
+		servers = append(servers, d.Server)
+	}
+	windows := append(removeSyncWindows(current.Spec.SyncWindows, servers), desired.Spec.SyncWindows...)
+
+	if err := setSpecField(existing, "roles", current.Spec.Roles); err != nil {
+		return err
+	}
+	if err := setSyncWindows(existing, windows); err != nil {
+		return err
+	}
+	return setSpecField(existing, "destinations", current.Spec.Destinations)
+}
+
+// RemoveFromProject takes the destinations and sync windows of servers and the roles out of a
+// shared project
+func RemoveFromProject(existing *unstructured.Unstructured, servers []string, roles []string) error {
+	current := ArgoProject{}
+	if err := fromUnstructured(existing, &current); err != nil {
+		return err
+	}
+	if err := setSpecField(existing, "roles", removeRoles(current.Spec.Roles, roles)); err != nil {
+		return err
+	}
+	if err := setSyncWindows(existing, removeSyncWindows(current.Spec.SyncWindows, servers)); err != nil {
+		return err
+	}
+	return setSpecField(existing, "destinations", removeDestinations(current.Spec.Destinations, servers))
+}
+
+// ReleaseProject removes what a config added to a project other configs still use
+func ReleaseProject(ctx context.Context, c client.Client, namespace string, name string, servers []string, roles []string) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(AppProjectGVK)
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, existing); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if err := RemoveFromProject(existing, servers, roles); err != nil {
+		return err
+	}
+	if err := c.Update(ctx, existing); err != nil {
+		return fmt.Errorf("unable to update AppProject %s/%s\n%s -", namespace, name, err)
+	}
+	return nil
+}
+
+func removeDestinations(destinations []Destinations, servers []string) []Destinations {
+	kept := []Destinations{}
+	for _, d := range destinations {
+		if !contains(servers, d.Server) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func removeRoles(roles []Roles, names []string) []Roles {
+	kept := []Roles{}
+	for _, r := range roles {
+		if !contains(names, r.Name) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigProject renders the AppProject of the config with the roles of the config and the
+// maintenance sync window of the shoot recorded in the status
+func ConfigProject(s *customergardenerv1.Config, namespace string, api string) (ArgoProject, error) {
+	cid, err := ProjectName(s)
+	if err != nil {
+		return ArgoProject{}, err
+	}
+	project := ArgoCDProject(cid, namespace, api)
+	if s.Spec.AppProject == nil {
+		return project, nil
+	}
+	if len(s.Spec.AppProject.Roles) > 0 {
+		project.Spec.Roles = ProjectRoles(cid, s.Spec.AppProject.Roles)
+	}
+	if w := s.Spec.AppProject.MaintenanceWindow; w != nil && s.Status.Shoot != nil && s.Status.Shoot.Maintenance != nil {
+		window, err := MaintenanceSyncWindow(s.Status.Shoot.Maintenance, w.Mode, api)
+		if err != nil {
+			return project, err
+		}
+		project.Spec.SyncWindows = []SyncWindow{window}
+	}
+	return project, nil
+}
+
+// ProjectRoles renders the roles of the config into the roles of the project cid
+func ProjectRoles(cid string, roles []customergardenerv1.ProjectRole) []Roles {
+	rendered := make([]Roles, 0, len(roles))
+	for _, role := range roles {
+		r := Roles{
+			Name:        role.Name,
+			Description: role.Description,
+			Policies:    []string{},
+			Groups:      role.Groups,
+		}
+		for _, p := range role.Policies {
+			object := p.Object
+			if object == "" {
+				object = "*"
+			}
+			permission := p.Permission
+			if permission == "" {
+				permission = "allow"
+			}
+			r.Policies = append(r.Policies, fmt.Sprintf("p, proj:%s:%s, %s, %s, %s/%s, %s",
+				cid, role.Name, p.Resource, p.Action, cid, object, permission))
+		}
+		rendered = append(rendered, r)
+	}
+	return rendered
+}
+
+// toUnstructured converts a rendered ArgoCD object into an object the client can send
+func toUnstructured(object interface{}) (*unstructured.Unstructured, error) {
+	body, err := json.Marshal(object)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
-	// creates the in-cluster config
-	config, err := rest.InClusterConfig()
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(body); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// fromUnstructured reads an unstructured object into one of the rendered ArgoCD types
+func fromUnstructured(u *unstructured.Unstructured, object interface{}) error {
+	body, err := u.MarshalJSON()
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+	return json.Unmarshal(body, object)
+}
+
+// setSyncWindows replaces the sync windows of the project, the field is dropped without any
+func setSyncWindows(u *unstructured.Unstructured, windows []SyncWindow) error {
+	if len(windows) == 0 {
+		unstructured.RemoveNestedField(u.Object, "spec", "syncWindows")
+		return nil
 	}
-	// creates the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	return setSpecField(u, "syncWindows", windows)
+}
+
+// setSpecField replaces a field of the spec of an unstructured object with a rendered value
+func setSpecField(u *unstructured.Unstructured, field string, value interface{}) error {
+	body, err := json.Marshal(value)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	_, err = clientset.RESTClient().
-		Post().
-		AbsPath(fmt.Sprintf("apis/argoproj.io/v1alpha1/namespaces/%s/appprojects", input.S.ObjectMeta.Namespace)).
-		Body(json).
-		DoRaw(context.TODO())
-	return err
+	var converted interface{}
+	if err := json.Unmarshal(body, &converted); err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(u.Object, converted, "spec", field)
 }
 
 func ArgoCDProject(cid string, namespace string, api string) ArgoProject {
@@ -107,6 +369,9 @@ func ArgoCDProject(cid string, namespace string, api string) ArgoProject {
 			Annotations: map[string]string{
 				"argocd.argoproj.io/sync-wave": "0",
 			},
+			Labels: map[string]string{
+				customergardenerv1.ManagedByLabel: customergardenerv1.ManagedByValue,
+			},
 			Name:      cid,
 			Namespace: namespace,
 		},
@@ -0,0 +1,197 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+var _ = Describe("AppProject", func() {
+	ctx := context.Background()
+	var config *customergardenerv1.Config
+
+	getProject := func(name string) (*unstructured.Unstructured, error) {
+		project := &unstructured.Unstructured{}
+		project.SetGroupVersionKind(AppProjectGVK)
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: config.Namespace, Name: name}, project)
+		return project, err
+	}
+
+	BeforeEach(func() {
+		if k8sClient == nil {
+			Skip("SKIP_ENVTEST set, no API server to test against")
+		}
+		namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("argocd-%d", time.Now().UnixNano()),
+		}}
+		Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+		config = &customergardenerv1.Config{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace.Name, Name: "shoot"},
+			Spec: customergardenerv1.ConfigSpec{
+				DesiredOutput: "ArgoCD",
+				Project:       "garden",
+				Shoot:         "shoot-abc123",
+			},
+		}
+	})
+
+	It("creates the project with the shoot as destination", func() {
+		Expect(CreateProject(ctx, k8sClient, &Input{S: config}, "https://api.shoot.example.com")).To(Succeed())
+
+		project, err := getProject("abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(project.GetLabels()).To(HaveKeyWithValue(customergardenerv1.ManagedByLabel, customergardenerv1.ManagedByValue))
+		destinations, _, err := unstructured.NestedSlice(project.Object, "spec", "destinations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(destinations).To(ConsistOf(HaveKeyWithValue("server", "https://api.shoot.example.com")))
+	})
+
+	It("accepts a project managed by the operator", func() {
+		Expect(CreateProject(ctx, k8sClient, &Input{S: config}, "https://api.shoot.example.com")).To(Succeed())
+		Expect(CreateProject(ctx, k8sClient, &Input{S: config}, "https://api.shoot.example.com")).To(Succeed())
+	})
+
+	It("refuses a foreign project", func() {
+		foreign, err := toUnstructured(ArgoCDProject("abc", config.Namespace, "https://api.other.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		foreign.SetLabels(nil)
+		Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+
+		Expect(CreateProject(ctx, k8sClient, &Input{S: config}, "https://api.shoot.example.com")).NotTo(Succeed())
+	})
+
+	It("deletes the project and ignores a missing one", func() {
+		Expect(CreateProject(ctx, k8sClient, &Input{S: config}, "https://api.shoot.example.com")).To(Succeed())
+
+		Expect(DeleteProject(ctx, k8sClient, config.Namespace, "abc")).To(Succeed())
+		_, err := getProject("abc")
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(DeleteProject(ctx, k8sClient, config.Namespace, "abc")).To(Succeed())
+	})
+})
+
+var _ = Describe("ProjectRoles", func() {
+	It("renders policies and groups of the roles", func() {
+		roles := ProjectRoles("abc", []customergardenerv1.ProjectRole{{
+			Name:   "developers",
+			Groups: []string{"abc-developers"},
+			Policies: []customergardenerv1.ProjectPolicy{
+				{Resource: "applications", Action: "sync"},
+				{Resource: "exec", Action: "create", Object: "app-*", Permission: "deny"},
+			},
+		}})
+		Expect(roles).To(HaveLen(1))
+		Expect(roles[0].Groups).To(Equal([]string{"abc-developers"}))
+		Expect(roles[0].Policies).To(Equal([]string{
+			"p, proj:abc:developers, applications, sync, abc/*, allow",
+			"p, proj:abc:developers, exec, create, abc/app-*, deny",
+		}))
+	})
+})
+
+var _ = Describe("MaintenanceSyncWindow", func() {
+	It("renders the maintenance time window in UTC", func() {
+		window, err := MaintenanceSyncWindow(&customergardenerv1.MaintenanceWindow{Begin: "233000+0200", End: "003000+0200"}, "Manual", "https://api.shoot.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(window).To(Equal(SyncWindow{
+			Kind:         "deny",
+			Schedule:     "30 21 * * *",
+			Duration:     "60m",
+			Applications: []string{"*"},
+			Clusters:     []string{"https://api.shoot.example.com"},
+			ManualSync:   true,
+			TimeZone:     "UTC",
+		}))
+	})
+
+	It("rejects a malformed window", func() {
+		_, err := MaintenanceSyncWindow(&customergardenerv1.MaintenanceWindow{Begin: "22:00", End: "230000+0000"}, "Deny", "https://api.shoot.example.com")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("replaces the window of the shoot in a shared project", func() {
+		config := &customergardenerv1.Config{
+			Spec: customergardenerv1.ConfigSpec{
+				Shoot:      "shoot-abc1",
+				AppProject: &customergardenerv1.AppProjectSpec{MaintenanceWindow: &customergardenerv1.MaintenanceSyncWindow{Mode: "Deny"}},
+			},
+			Status: customergardenerv1.ConfigStatus{
+				Shoot: &customergardenerv1.ShootStatus{Maintenance: &customergardenerv1.MaintenanceWindow{Begin: "030000+0000", End: "040000+0000"}},
+			},
+		}
+		existing := ArgoCDProject("abc", "argocd", "https://api.other.example.com")
+		existing.Spec.SyncWindows = []SyncWindow{
+			{Kind: "deny", Schedule: "0 1 * * *", Duration: "1h", Clusters: []string{"https://api.other.example.com"}},
+			{Kind: "deny", Schedule: "0 2 * * *", Duration: "1h", Clusters: []string{"https://api.shoot.example.com"}},
+		}
+		u, err := toUnstructured(existing)
+		Expect(err).NotTo(HaveOccurred())
+
+		desired, err := ConfigProject(config, "argocd", "https://api.shoot.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(MergeProject(u, desired, &Input{S: config})).To(Succeed())
+		merged := ArgoProject{}
+		Expect(fromUnstructured(u, &merged)).To(Succeed())
+		Expect(merged.Spec.SyncWindows).To(ConsistOf(
+			HaveField("Schedule", "0 1 * * *"),
+			HaveField("Schedule", "0 3 * * *")))
+
+		Expect(RemoveFromProject(u, []string{"https://api.shoot.example.com"}, nil)).To(Succeed())
+		merged = ArgoProject{}
+		Expect(fromUnstructured(u, &merged)).To(Succeed())
+		Expect(merged.Spec.SyncWindows).To(ConsistOf(HaveField("Schedule", "0 1 * * *")))
+	})
+})
+
+var _ = Describe("ProjectName", func() {
+	It("derives the customer id from the shoot name", func() {
+		name, err := ProjectName(&customergardenerv1.Config{Spec: customergardenerv1.ConfigSpec{Shoot: "shoot-abc1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("abc"))
+	})
+
+	It("prefers the name of the config", func() {
+		name, err := ProjectName(&customergardenerv1.Config{Spec: customergardenerv1.ConfigSpec{
+			Shoot:      "shoot",
+			AppProject: &customergardenerv1.AppProjectSpec{Name: "platform"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("platform"))
+	})
+
+	It("refuses shoot names without a customer id instead of panicking", func() {
+		for _, shoot := range []string{"shoot", "shoot-ab", "shoot-"} {
+			_, err := ProjectName(&customergardenerv1.Config{Spec: customergardenerv1.ConfigSpec{Shoot: shoot}})
+			Expect(err).To(HaveOccurred(), shoot)
+			_, err = ConfigProject(&customergardenerv1.Config{Spec: customergardenerv1.ConfigSpec{Shoot: shoot}}, "argocd", "https://api.shoot.example.com")
+			Expect(err).To(HaveOccurred(), shoot)
+		}
+	})
+})
@@ -0,0 +1,71 @@
+package argocd
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// strategies to assign ArgoCD application controller shards to clusters
+const (
+	// consistent hashing on the shoot name, only few clusters move when the shard count changes
+	ShardingHash = "hash"
+	// the shard with the fewest clusters
+	ShardingLeastLoaded = "least-loaded"
+)
+
+// Sharding is the operator wide shard assignment setting
+type Sharding struct {
+	// number of application controller shards, 0 disables the assignment
+	Shards int `json:"shards,omitempty"`
+	// one of ShardingHash or ShardingLeastLoaded
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// Enabled reports whether shards are assigned by the operator
+func (s Sharding) Enabled() bool {
+	return s.Shards > 0
+}
+
+// Validate checks the sharding setting
+func (s Sharding) Validate() error {
+	if s.Shards < 0 {
+		return fmt.Errorf("shard count must not be negative, got %d", s.Shards)
+	}
+	switch s.Strategy {
+	case ShardingHash, ShardingLeastLoaded:
+		return nil
+	default:
+		return fmt.Errorf("unknown shard strategy %q, use %s or %s", s.Strategy, ShardingHash, ShardingLeastLoaded)
+	}
+}
+
+// HashShard assigns a shard with jump consistent hashing on the cluster name
+func HashShard(name string, shards int) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	key := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(shards) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return b
+}
+
+// LeastLoadedShard picks a shard by the number of clusters per shard, loads must not count
+// the cluster itself. A valid current shard is kept unless another one has at least two
+// clusters less, so clusters do not flap between equally loaded shards.
+func LeastLoadedShard(loads []int, current *int64) int64 {
+	least := 0
+	for i, load := range loads {
+		if load < loads[least] {
+			least = i
+		}
+	}
+	if current != nil && *current >= 0 && *current < int64(len(loads)) && loads[*current] <= loads[least]+1 {
+		return *current
+	}
+	return int64(least)
+}
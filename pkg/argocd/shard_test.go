@@ -0,0 +1,70 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package argocd
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sharding", func() {
+	It("hashes a cluster to a stable shard in range", func() {
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprintf("shoot-%d", i)
+			shard := HashShard(name, 4)
+			Expect(shard).To(BeNumerically(">=", 0))
+			Expect(shard).To(BeNumerically("<", 4))
+			Expect(HashShard(name, 4)).To(Equal(shard))
+		}
+		Expect(HashShard("shoot", 1)).To(BeZero())
+	})
+
+	It("moves only few clusters when a shard is added", func() {
+		moved := 0
+		for i := 0; i < 1000; i++ {
+			name := fmt.Sprintf("shoot-%d", i)
+			if before, after := HashShard(name, 4), HashShard(name, 5); before != after {
+				// a moved cluster always goes to the new shard
+				Expect(after).To(Equal(int64(4)))
+				moved++
+			}
+		}
+		// about a fifth of the clusters
+		Expect(moved).To(BeNumerically("~", 200, 60))
+	})
+
+	It("picks the least loaded shard and keeps a current one within one cluster", func() {
+		Expect(LeastLoadedShard([]int{3, 1, 2}, nil)).To(Equal(int64(1)))
+
+		current := int64(2)
+		Expect(LeastLoadedShard([]int{3, 1, 2}, &current)).To(Equal(int64(2)))
+		current = 0
+		Expect(LeastLoadedShard([]int{3, 1, 2}, &current)).To(Equal(int64(1)))
+
+		// a shard out of range after the shard count shrank is not kept
+		current = 5
+		Expect(LeastLoadedShard([]int{1, 1}, &current)).To(Equal(int64(0)))
+	})
+
+	It("validates the setting", func() {
+		Expect(Sharding{Shards: 2, Strategy: ShardingHash}.Validate()).To(Succeed())
+		Expect(Sharding{Shards: -1, Strategy: ShardingHash}.Validate()).NotTo(Succeed())
+		Expect(Sharding{Shards: 2, Strategy: "random"}.Validate()).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,63 @@
+package argocd
+
+import (
+	"fmt"
+	"time"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+// SyncWindow is a sync window of an AppProject
+type SyncWindow struct {
+	Kind         string   `json:"kind"`
+	Schedule     string   `json:"schedule"`
+	Duration     string   `json:"duration"`
+	Applications []string `json:"applications,omitempty"`
+	Clusters     []string `json:"clusters,omitempty"`
+	ManualSync   bool     `json:"manualSync,omitempty"`
+	TimeZone     string   `json:"timeZone,omitempty"`
+}
+
+// gardener writes the maintenance time window as HHMMSS+ZZZZ
+const maintenanceTimeFormat = "150405-0700"
+
+// MaintenanceSyncWindow renders the daily maintenance time window of a shoot into a deny window
+// for the destination server, the schedule is converted to UTC so any zone offset works
+func MaintenanceSyncWindow(window *customergardenerv1.MaintenanceWindow, mode string, server string) (SyncWindow, error) {
+	begin, err := time.Parse(maintenanceTimeFormat, window.Begin)
+	if err != nil {
+		return SyncWindow{}, fmt.Errorf("invalid begin %q of the maintenance time window.\n%s -", window.Begin, err)
+	}
+	end, err := time.Parse(maintenanceTimeFormat, window.End)
+	if err != nil {
+		return SyncWindow{}, fmt.Errorf("invalid end %q of the maintenance time window.\n%s -", window.End, err)
+	}
+	duration := end.Sub(begin)
+	// the window crosses midnight
+	for duration <= 0 {
+		duration += 24 * time.Hour
+	}
+	begin = begin.UTC()
+	return SyncWindow{
+		Kind:         "deny",
+		Schedule:     fmt.Sprintf("%d %d * * *", begin.Minute(), begin.Hour()),
+		Duration:     fmt.Sprintf("%dm", int(duration.Minutes())),
+		Applications: []string{"*"},
+		Clusters:     []string{server},
+		ManualSync:   mode == "Manual",
+		TimeZone:     "UTC",
+	}, nil
+}
+
+// removeSyncWindows drops the windows limited to exactly one of the servers, windows other
+// configs or users added for several clusters are kept
+func removeSyncWindows(windows []SyncWindow, servers []string) []SyncWindow {
+	kept := []SyncWindow{}
+	for _, w := range windows {
+		if len(w.Clusters) == 1 && contains(servers, w.Clusters[0]) {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	return kept
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// actions recorded in the audit trail
+const (
+	ActionIssue  = "issue"
+	ActionDelete = "delete"
+)
+
+// Record is one entry of the audit trail
+type Record struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason,omitempty"`
+	ConfigUID string    `json:"configUID"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Project   string    `json:"project"`
+	Shoot     string    `json:"shoot"`
+	// kind of the issued credential, e.g. client-certificate
+	CredentialType string     `json:"credentialType,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	SerialNumber   string     `json:"serialNumber,omitempty"`
+	Fingerprint    string     `json:"fingerprint,omitempty"`
+	// where the credential was written to, e.g. secret:<namespace>/<name>
+	Targets []string `json:"targets"`
+}
+
+// Sink receives audit records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// NewSink returns the sink for a target: "stdout", "file:<path>" or a http(s) webhook URL
+func NewSink(target string) (Sink, error) {
+	switch {
+	case target == "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case strings.HasPrefix(target, "file:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(target, "file:"), "//")
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit file %s.\n%s -", path, err)
+		}
+		return &writerSink{w: f}, nil
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		return &webhookSink{url: target, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q, use stdout, file:<path> or a webhook URL", target)
+	}
+}
+
+// writes one JSON record per line
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// posts every record as JSON
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Write(ctx context.Context, record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send audit record.\n%s -", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook responded %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package gardener
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ArgoCD cluster secret config, see
+// https://argo-cd.readthedocs.io/en/stable/operator-manual/declarative-setup/#clusters
+type ArgoClusterConfig struct {
+	TLSClientConfig    ArgoTLSClientConfig                    `json:"tlsClientConfig"`
+	ExecProviderConfig *customergardenerv1.ExecProviderConfig `json:"execProviderConfig,omitempty"`
+	AWSAuthConfig      *customergardenerv1.AWSAuthConfig      `json:"awsAuthConfig,omitempty"`
+	ProxyURL           string                                 `json:"proxyUrl,omitempty"`
+}
+
+type ArgoTLSClientConfig struct {
+	CaData   string `json:"caData,omitempty"`
+	CertData string `json:"certData,omitempty"`
+	KeyData  string `json:"keyData,omitempty"`
+}
+
+// SecretShard returns the shard of an ArgoCD cluster secret, nil if it has none
+func SecretShard(secret *v1.Secret) *int64 {
+	value, ok := secret.Data["shard"]
+	if !ok {
+		return nil
+	}
+	shard, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &shard
+}
+
+// ArgoCDClusterData renders the data of an ArgoCD cluster secret for the config
+func ArgoCDClusterData(input *Input, server string, tls ArgoTLSClientConfig) (map[string][]byte, error) {
+	s := input.S
+	config := ArgoClusterConfig{TLSClientConfig: tls}
+	data := map[string][]byte{
+		"name":   []byte(s.Spec.Shoot),
+		"server": []byte(server),
+	}
+
+	if out := s.Spec.ArgoCD; out != nil {
+		config.ExecProviderConfig = out.ExecProviderConfig
+		config.AWSAuthConfig = out.AWSAuthConfig
+		config.ProxyURL = out.ProxyURL
+		// another authentication is configured, only the CA is kept to verify the server
+		if out.ExecProviderConfig != nil || out.AWSAuthConfig != nil {
+			config.TLSClientConfig.CertData = ""
+			config.TLSClientConfig.KeyData = ""
+		}
+
+		if len(out.Namespaces) > 0 {
+			data["namespaces"] = []byte(strings.Join(out.Namespaces, ","))
+			if out.ClusterResources {
+				data["clusterResources"] = []byte("true")
+			}
+		}
+		if out.Project != "" {
+			data["project"] = []byte(out.Project)
+		}
+	}
+
+	shard := input.Shard
+	if shard == nil && s.Spec.ArgoCD != nil {
+		shard = s.Spec.ArgoCD.Shard
+	}
+	if shard != nil {
+		data["shard"] = []byte(strconv.FormatInt(*shard, 10))
+	}
+
+	byteConfig, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("error on ArgoCD config Marshaling.\n%s -", err)
+	}
+	data["config"] = byteConfig
+	return data, nil
+}
+
+// ClientCertificateMissing reports whether the config authenticates ArgoCD with a client
+// certificate but the cluster secret holds none, e.g. after the exec or AWS authentication was
+// removed. Only new credentials fill the gap, the secret is due for a rotation.
+func ClientCertificateMissing(s *customergardenerv1.Config, secret *v1.Secret) bool {
+	if out := s.Spec.ArgoCD; out != nil && (out.ExecProviderConfig != nil || out.AWSAuthConfig != nil) {
+		return false
+	}
+	config := ArgoClusterConfig{}
+	if err := json.Unmarshal(secret.Data["config"], &config); err != nil {
+		return true
+	}
+	return config.TLSClientConfig.CertData == "" || config.TLSClientConfig.KeyData == ""
+}
+
+// RefreshArgoCDClusterData renders the data of an existing ArgoCD cluster secret again,
+// the server and the credentials already stored in the secret are kept
+func RefreshArgoCDClusterData(input *Input, secret *v1.Secret) (map[string][]byte, error) {
+	config := ArgoClusterConfig{}
+	if err := json.Unmarshal(secret.Data["config"], &config); err != nil {
+		return nil, fmt.Errorf("error on ArgoCD config Unmarshaling.\n%s -", err)
+	}
+	return ArgoCDClusterData(input, string(secret.Data["server"]), config.TLSClientConfig)
+}
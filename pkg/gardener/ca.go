@@ -0,0 +1,81 @@
+package gardener
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// phases of a gardener shoot CA rotation
+const (
+	CARotationPreparing  = "Preparing"
+	CARotationPrepared   = "Prepared"
+	CARotationCompleting = "Completing"
+	CARotationCompleted  = "Completed"
+)
+
+// gardener publishes the CA bundle of a shoot in the project namespace
+// under <shoot>.ca-cluster, during a rotation it holds the old and the new CA
+const caBundleSecretSuffix = ".ca-cluster"
+
+// CARotationInProgress reports whether the old and the new CA are both valid in the given phase
+func CARotationInProgress(phase string) bool {
+	switch phase {
+	case CARotationPreparing, CARotationPrepared, CARotationCompleting:
+		return true
+	default:
+		return false
+	}
+}
+
+// read the base64 encoded CA bundle of the shoot from the garden cluster
+func getCABundle(ctx context.Context, project string, shoot string) (string, error) {
+	clientset, err := gardenClientset()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := requestContext(ctx)
+	defer cancel()
+
+	secret, err := clientset.CoreV1().
+		Secrets(fmt.Sprintf("garden-%s", project)).
+		Get(ctx, shoot+caBundleSecretSuffix, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to read CA bundle of shoot %s.\n%s -", shoot, err)
+	}
+
+	bundle, ok := secret.Data["ca.crt"]
+	if !ok || len(bundle) == 0 {
+		return "", fmt.Errorf("CA bundle of shoot %s is empty", shoot)
+	}
+	return base64.StdEncoding.EncodeToString(bundle), nil
+}
+
+// replace the certificate authority of every cluster in a base64 encoded kubeconfig
+func replaceCAData(encodedKubeconfig string, caBundle string) (string, error) {
+	sDec, err := base64.StdEncoding.DecodeString(encodedKubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error on YAML Encode.\n%s -", err)
+	}
+	caData, err := base64.StdEncoding.DecodeString(caBundle)
+	if err != nil {
+		return "", fmt.Errorf("error on CA bundle decode.\n%s -", err)
+	}
+
+	kubeconfig, err := clientcmd.Load(sDec)
+	if err != nil {
+		return "", fmt.Errorf("error on kubeconfig load.\n%s -", err)
+	}
+	for _, cluster := range kubeconfig.Clusters {
+		cluster.CertificateAuthorityData = caData
+	}
+
+	out, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error on kubeconfig write.\n%s -", err)
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
@@ -0,0 +1,72 @@
+package gardener
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Certificate describes the client certificate issued for a shoot
+type Certificate struct {
+	SerialNumber string
+	// hex encoded SHA-256 of the DER certificate
+	Fingerprint string
+	NotAfter    time.Time
+}
+
+// ClientCertificate returns the client certificate stored in a generated secret,
+// nil if the secret authenticates another way
+func ClientCertificate(secret *v1.Secret) (*Certificate, error) {
+	var certPEM []byte
+	if config, ok := secret.Data["config"]; ok {
+		parsed := ArgoClusterConfig{}
+		if err := json.Unmarshal(config, &parsed); err != nil {
+			return nil, fmt.Errorf("error on ArgoCD config Unmarshaling.\n%s -", err)
+		}
+		if parsed.TLSClientConfig.CertData == "" {
+			return nil, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(parsed.TLSClientConfig.CertData)
+		if err != nil {
+			return nil, fmt.Errorf("error on certificate decode.\n%s -", err)
+		}
+		certPEM = decoded
+	} else if kubeconfig, ok := secret.Data["kubeconfig"]; ok {
+		config, err := clientcmd.Load(kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("error on kubeconfig load.\n%s -", err)
+		}
+		for _, user := range config.AuthInfos {
+			if len(user.ClientCertificateData) > 0 {
+				certPEM = user.ClientCertificateData
+				break
+			}
+		}
+	}
+	if len(certPEM) == 0 {
+		return nil, nil
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error on certificate parse.\n%s -", err)
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	return &Certificate{
+		SerialNumber: cert.SerialNumber.Text(16),
+		Fingerprint:  hex.EncodeToString(fingerprint[:]),
+		NotAfter:     cert.NotAfter,
+	}, nil
+}
@@ -5,16 +5,14 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os"
 
 	"gopkg.in/yaml.v3"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 // logic for the controller
-func GetConfig(project string, shoot string, secondsToExpiration int, output string) ([]string, error) {
-	newConfig, err := getClusterConfig(project, shoot, secondsToExpiration)
+func GetConfig(ctx context.Context, project string, shoot string, secondsToExpiration int, output string) ([]string, error) {
+	newConfig, err := getClusterConfig(ctx, project, shoot, secondsToExpiration)
 	if err != nil {
 		return nil, fmt.Errorf("something went wrong get the shoot cluster config, check if cluster %s exsists\n %s", shoot, err)
 	}
@@ -91,17 +89,13 @@ type KubeConfig struct {
 }
 
 // generate the kubeconfig out of the gardener seed cluster
-func getClusterConfig(project string, shoot string, expiration int) (string, error) {
-	kubeconfig := os.Getenv(kubeConfigEnvName)
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+func getClusterConfig(ctx context.Context, project string, shoot string, expiration int) (string, error) {
+	clientset, err := gardenClientset()
 	if err != nil {
-		return "", fmt.Errorf("error in the current context.\n%s -", err)
+		return "", err
 	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return "", fmt.Errorf("error on clientset.\n%s -", err)
+	if err := adminKubeconfigLimiter.Wait(ctx); err != nil {
+		return "", fmt.Errorf("unable to wait for the AdminKubeconfigRequest rate limit.\n%s -", err)
 	}
 
 	expire := ConfigSpec{ExpirationSeconds: expiration}
@@ -111,14 +105,16 @@ func getClusterConfig(project string, shoot string, expiration int) (string, err
 		return "", fmt.Errorf("error on response.\n%s -", err)
 	}
 
+	ctx, cancel := requestContext(ctx)
+	defer cancel()
+
 	resp, err := clientset.RESTClient().
 		Post().
 		AbsPath(fmt.Sprintf("apis/core.gardener.cloud/v1beta1/namespaces/garden-%s/shoots/%s/adminkubeconfig", project, shoot)).
 		Body(json).
-		DoRaw(context.TODO())
+		DoRaw(ctx)
 	if err != nil {
-
-		fmt.Println(string(resp), err)
+		return "", fmt.Errorf("unable to request an admin kubeconfig of shoot %s.\n%s -", shoot, err)
 	}
 
 	data := JsonResponse{}
@@ -157,3 +153,20 @@ func yamlParse(encodedYaml string) ([]string, error) {
 	}
 	return []string{caData, clusterAddress, certData, keyData}, nil
 }
+
+// return the server of the current context of a kubeconfig
+func kubeconfigServer(kubeconfig []byte) string {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return ""
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return ""
+	}
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok {
+		return ""
+	}
+	return cluster.Server
+}
@@ -0,0 +1,101 @@
+package gardener
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Connection describes how the garden cluster is reached
+type Connection struct {
+	// path of the kubeconfig for the garden cluster, the in-cluster config is used if empty
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// client side rate limit of requests to the garden cluster, the client-go defaults are
+	// used if 0
+	QPS   float32 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+	// token bucket for AdminKubeconfigRequests shared by all reconciles, so rotations due at
+	// the same time do not hit the garden at once. 0 disables the limit.
+	AdminKubeconfigQPS   float64 `json:"adminKubeconfigQPS,omitempty"`
+	AdminKubeconfigBurst int     `json:"adminKubeconfigBurst,omitempty"`
+	// upper bound of a single request to the garden cluster, unbounded if empty
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+var (
+	connectionMu sync.RWMutex
+	connection   Connection
+	// built on first use after SetConnection, so its rate limiter is shared by all requests
+	clientset *kubernetes.Clientset
+	// keeps its tokens when the connection is replaced
+	adminKubeconfigLimiter = rate.NewLimiter(rate.Inf, 0)
+)
+
+// SetConnection replaces the connection used for all following garden requests
+func SetConnection(c Connection) {
+	connectionMu.Lock()
+	defer connectionMu.Unlock()
+	connection = c
+	clientset = nil
+
+	if c.AdminKubeconfigQPS <= 0 {
+		adminKubeconfigLimiter.SetLimit(rate.Inf)
+		return
+	}
+	burst := c.AdminKubeconfigBurst
+	if burst < 1 {
+		burst = 1
+	}
+	adminKubeconfigLimiter.SetBurst(burst)
+	adminKubeconfigLimiter.SetLimit(rate.Limit(c.AdminKubeconfigQPS))
+}
+
+// requestContext bounds a single garden request by the configured timeout, the request is
+// cancelled with the parent context as well
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	connectionMu.RLock()
+	timeout := connection.Timeout
+	connectionMu.RUnlock()
+
+	if timeout == nil || timeout.Duration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout.Duration)
+}
+
+// gardenClientset returns the client for the garden cluster. It is built once per connection,
+// all reconciles share its QPS and burst. Tokens of the in-cluster config or a token file are
+// reloaded by client-go, a changed kubeconfig takes effect with the next SetConnection.
+func gardenClientset() (*kubernetes.Clientset, error) {
+	connectionMu.RLock()
+	cached := clientset
+	connectionMu.RUnlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	connectionMu.Lock()
+	defer connectionMu.Unlock()
+	if clientset != nil {
+		return clientset, nil
+	}
+	// use the current context in kubeconfig
+	config, err := clientcmd.BuildConfigFromFlags("", connection.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("error in the current context.\n%s -", err)
+	}
+	config.QPS = connection.QPS
+	config.Burst = connection.Burst
+
+	built, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error on clientset.\n%s -", err)
+	}
+	clientset = built
+	return clientset, nil
+}
@@ -0,0 +1,99 @@
+package gardener
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ContentHash hashes everything of a generated secret which is not rotated with the
+// credentials: labels, foreign annotations, server and the non-credential config
+func ContentHash(secret *v1.Secret) (string, error) {
+	h := sha256.New()
+
+	for _, k := range sortedKeys(secret.Labels) {
+		fmt.Fprintf(h, "label:%s=%s\n", k, secret.Labels[k])
+	}
+	for _, k := range sortedKeys(secret.Annotations) {
+		// the operator annotations change with every rotation
+		if strings.HasPrefix(k, "configs.customer.gardener/") {
+			continue
+		}
+		fmt.Fprintf(h, "annotation:%s=%s\n", k, secret.Annotations[k])
+	}
+
+	dataKeys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		dataKeys = append(dataKeys, k)
+	}
+	sort.Strings(dataKeys)
+
+	for _, k := range dataKeys {
+		value := secret.Data[k]
+		switch k {
+		case "config":
+			stripped, err := stripArgoCredentials(value)
+			if err != nil {
+				return "", err
+			}
+			value = stripped
+		case "kubeconfig":
+			stripped, err := stripKubeconfigCredentials(value)
+			if err != nil {
+				return "", err
+			}
+			value = stripped
+		}
+		fmt.Fprintf(h, "data:%s=%s\n", k, value)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remove the client certificate from an ArgoCD cluster config
+func stripArgoCredentials(config []byte) ([]byte, error) {
+	parsed := map[string]interface{}{}
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		return nil, fmt.Errorf("error on ArgoCD config Unmarshaling.\n%s -", err)
+	}
+	if tls, ok := parsed["tlsClientConfig"].(map[string]interface{}); ok {
+		delete(tls, "certData")
+		delete(tls, "keyData")
+	}
+	// map keys are sorted by json.Marshal, so the result is stable
+	return json.Marshal(parsed)
+}
+
+// keep only the cluster endpoints and CAs of a kubeconfig
+func stripKubeconfigCredentials(kubeconfig []byte) ([]byte, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("error on kubeconfig load.\n%s -", err)
+	}
+	var b strings.Builder
+	names := make([]string, 0, len(config.Clusters))
+	for name := range config.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cluster := config.Clusters[name]
+		fmt.Fprintf(&b, "%s %s %x\n", name, cluster.Server, cluster.CertificateAuthorityData)
+	}
+	return []byte(b.String()), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -4,65 +4,182 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"sort"
 
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	customergardenerv1 "customer.gardener/config/api/v1"
 )
 
-func GetInfo(project string, shoot string) ([]string, error) {
-	purposeRaw, provider, err := getInfo(project, shoot)
+// Info holds the shoot attributes used to build the generated secrets
+type Info struct {
+	// the gardener purpose, mapped to a stage with a StageMapping
+	Purpose           string
+	Provider          string
+	Region            string
+	SeedName          string
+	KubernetesVersion string
+	Networking        string
+	MachineTypes      []string
+	Zones             []string
+	Labels            map[string]string
+	Annotations       map[string]string
+	// phase of the shoot CA rotation, empty if no rotation was ever triggered
+	CARotationPhase string
+	// daily maintenance time window, nil if the shoot has none
+	Maintenance *customergardenerv1.MaintenanceWindow
+}
+
+func GetInfo(ctx context.Context, project string, shoot string) (*Info, error) {
+	data, err := getInfo(ctx, project, shoot)
 	if err != nil {
-		return nil, fmt.Errorf(fmt.Sprintf("something went wrong get shoot cluster info, check if cluster %s exsists", shoot))
+		return nil, fmt.Errorf("something went wrong get shoot cluster info, check if cluster %s exsists.\n%s -", shoot, err)
+	}
+	seedName := data.Status.SeedName
+	if seedName == "" {
+		seedName = data.Spec.SeedName
+	}
+
+	// unique machine types and zones over all worker pools
+	var machineTypes, zones []string
+	seen := map[string]bool{}
+	for _, worker := range data.Spec.Provider.Workers {
+		if !seen["machine:"+worker.Machine.Type] {
+			seen["machine:"+worker.Machine.Type] = true
+			machineTypes = append(machineTypes, worker.Machine.Type)
+		}
+		for _, zone := range worker.Zones {
+			if !seen["zone:"+zone] {
+				seen["zone:"+zone] = true
+				zones = append(zones, zone)
+			}
+		}
 	}
-	purpose := purposeShort(purposeRaw)
-	return []string{purpose, provider}, nil
+	sort.Strings(machineTypes)
+	sort.Strings(zones)
+
+	var maintenance *customergardenerv1.MaintenanceWindow
+	if window := data.Spec.Maintenance.TimeWindow; window.Begin != "" && window.End != "" {
+		maintenance = &customergardenerv1.MaintenanceWindow{Begin: window.Begin, End: window.End}
+	}
+
+	return &Info{
+		Purpose:           data.Spec.Purpose,
+		Provider:          data.Spec.Provider.Type,
+		Region:            data.Spec.Region,
+		SeedName:          seedName,
+		KubernetesVersion: data.Spec.Kubernetes.Version,
+		Networking:        data.Spec.Networking.Type,
+		MachineTypes:      machineTypes,
+		Zones:             zones,
+		Labels:            data.Metadata.Labels,
+		Annotations:       data.Metadata.Annotations,
+		CARotationPhase:   data.Status.Credentials.Rotation.CertificateAuthorities.Phase,
+		Maintenance:       maintenance,
+	}, nil
+}
+
+type Metadata struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 type Spec struct {
-	Provider Provider `json:"provider"`
-	Purpose  string   `json:"purpose"`
+	Provider    Provider    `json:"provider"`
+	Purpose     string      `json:"purpose"`
+	Region      string      `json:"region"`
+	SeedName    string      `json:"seedName"`
+	Kubernetes  Kubernetes  `json:"kubernetes"`
+	Networking  Networking  `json:"networking"`
+	Maintenance Maintenance `json:"maintenance"`
+}
+
+type Maintenance struct {
+	TimeWindow TimeWindow `json:"timeWindow"`
+}
+
+type TimeWindow struct {
+	Begin string `json:"begin"`
+	End   string `json:"end"`
+}
+
+type Networking struct {
+	Type string `json:"type"`
+}
+
+type Kubernetes struct {
+	Version string `json:"version"`
 }
 
 type Provider struct {
+	Type    string   `json:"type"`
+	Workers []Worker `json:"workers"`
+}
+
+type Worker struct {
+	Name    string   `json:"name"`
+	Machine Machine  `json:"machine"`
+	Zones   []string `json:"zones"`
+}
+
+type Machine struct {
 	Type string `json:"type"`
 }
 
-type InfoJsonResponse struct {
-	Spec Spec `json:"spec"`
+type Status struct {
+	SeedName    string      `json:"seedName"`
+	Credentials Credentials `json:"credentials"`
 }
 
-func purposeShort(purpose string) string {
-	if purpose == "production" {
-		return "prod"
-	} else {
-		return "dev"
-	}
+type Credentials struct {
+	Rotation Rotation `json:"rotation"`
 }
 
-func getInfo(project string, shoot string) (string, string, error) {
-	kubeconfig := os.Getenv(kubeConfigEnvName)
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
-		return "", "", fmt.Errorf("error on response.\n%s -", err)
-	}
+type Rotation struct {
+	CertificateAuthorities CertificateAuthoritiesRotation `json:"certificateAuthorities"`
+}
+
+type CertificateAuthoritiesRotation struct {
+	Phase string `json:"phase"`
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
+type InfoJsonResponse struct {
+	Metadata Metadata `json:"metadata"`
+	Spec     Spec     `json:"spec"`
+	Status   Status   `json:"status"`
+}
+
+func getInfo(ctx context.Context, project string, shoot string) (*InfoJsonResponse, error) {
+	clientset, err := gardenClientset()
 	if err != nil {
-		return "", "", fmt.Errorf("error on clientset.\n%s -", err)
+		return nil, err
 	}
+	ctx, cancel := requestContext(ctx)
+	defer cancel()
 
 	resp, err := clientset.RESTClient().
 		Get().
 		AbsPath(fmt.Sprintf("apis/core.gardener.cloud/v1beta1/namespaces/garden-%s/shoots/%s", project, shoot)).
-		DoRaw(context.TODO())
+		DoRaw(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("error on clientset.\n%s -", err)
+		return nil, fmt.Errorf("error on clientset.\n%s -", err)
 	}
 
 	data := InfoJsonResponse{}
 	json.Unmarshal(resp, &data)
 
-	return data.Spec.Purpose, data.Spec.Provider.Type, nil
+	return &data, nil
+}
+
+// ShootStatus returns the shoot attributes recorded in the config status
+func (i *Info) ShootStatus(stages *StageMapping) *customergardenerv1.ShootStatus {
+	return &customergardenerv1.ShootStatus{
+		Purpose:           i.Purpose,
+		Stage:             stages.Stage(i),
+		Region:            i.Region,
+		SeedName:          i.SeedName,
+		KubernetesVersion: i.KubernetesVersion,
+		Networking:        i.Networking,
+		MachineTypes:      i.MachineTypes,
+		Zones:             i.Zones,
+		Maintenance:       i.Maintenance,
+	}
 }
@@ -0,0 +1,201 @@
+package gardener
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// prefixes of the labels describing the shoot
+const (
+	shootLabelPrefix       = "customer.gardener/"
+	machineTypeLabelPrefix = "machine-type.customer.gardener/"
+	zoneLabelPrefix        = "zone.customer.gardener/"
+)
+
+// ShootLabels returns the labels describing the shoot, machine types and zones
+// get one label each so they can be selected with an exists expression
+func ShootLabels(info *Info) map[string]string {
+	labels := map[string]string{}
+	set := func(key string, value string) {
+		if value != "" && len(validation.IsValidLabelValue(value)) == 0 {
+			labels[key] = value
+		}
+	}
+	set(shootLabelPrefix+"region", info.Region)
+	set(shootLabelPrefix+"seed", info.SeedName)
+	set(shootLabelPrefix+"kubernetes-version", info.KubernetesVersion)
+	if parts := strings.SplitN(info.KubernetesVersion, ".", 3); len(parts) >= 2 {
+		set(shootLabelPrefix+"kubernetes-minor-version", parts[0]+"."+parts[1])
+	}
+	set(shootLabelPrefix+"networking", info.Networking)
+
+	for _, machineType := range info.MachineTypes {
+		if len(validation.IsQualifiedName(machineTypeLabelPrefix+machineType)) == 0 {
+			labels[machineTypeLabelPrefix+machineType] = "true"
+		}
+	}
+	for _, zone := range info.Zones {
+		if len(validation.IsQualifiedName(zoneLabelPrefix+zone)) == 0 {
+			labels[zoneLabelPrefix+zone] = "true"
+		}
+	}
+	return labels
+}
+
+// TemplateData is passed to templated label and annotation values,
+// e.g. "{{ .Shoot.Region }}" or `{{ index .Shoot.Labels "team" }}`
+type TemplateData struct {
+	Config *customergardenerv1.Config
+	Shoot  *Info
+}
+
+// GenerateLabels returns the labels of the generated secret. Propagated shoot labels are
+// overridden by the labels of the config, the labels describing the shoot and the ones
+// ArgoCD relies on always win. An invalid propagated label is skipped, the shoot is not under
+// control of the config, an invalid label of the config is an error.
+func GenerateLabels(ctx context.Context, input *Input, info *Info) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, key := range input.S.Spec.PropagateShootLabels {
+		value, ok := info.Labels[key]
+		if !ok {
+			continue
+		}
+		if errs := labelErrors(key, value); len(errs) > 0 {
+			log.FromContext(ctx).Info(fmt.Sprintf("Skip shoot label %s: %s", key, strings.Join(errs, ", ")))
+			continue
+		}
+		labels[key] = value
+	}
+	configured := map[string]string{}
+	if err := renderInto(configured, input.S.Spec.Labels, input, info); err != nil {
+		return nil, err
+	}
+	for key, value := range configured {
+		if errs := labelErrors(key, value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label %s=%q: %s", key, value, strings.Join(errs, ", "))
+		}
+		labels[key] = value
+	}
+	for key, value := range ShootLabels(info) {
+		labels[key] = value
+	}
+
+	labels[customergardenerv1.ManagedByLabel] = customergardenerv1.ManagedByValue
+	if input.S.Spec.DesiredOutput == "ArgoCD" {
+		labels["argocd.argoproj.io/secret-type"] = "cluster"
+		labels["clustername"] = input.S.Spec.Shoot
+
+		if input.S.Spec.Stage != "" {
+			labels["stage"] = input.S.Spec.Stage
+		} else {
+			// the stage mapping passes unmapped shoot label values through
+			stage := input.Stages.Stage(info)
+			if errs := validation.IsValidLabelValue(stage); len(errs) > 0 {
+				log.FromContext(ctx).Info(fmt.Sprintf("Skip stage label %q: %s", stage, strings.Join(errs, ", ")))
+			} else {
+				labels["stage"] = stage
+			}
+		}
+		if input.S.Spec.CloudProvider != "" {
+			labels["cloudprovider"] = input.S.Spec.CloudProvider
+		} else {
+			labels["cloudprovider"] = info.Provider
+		}
+	}
+
+	return labels, nil
+}
+
+// labelErrors validates the key and the value of a label
+func labelErrors(key string, value string) []string {
+	return append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...)
+}
+
+// GenerateAnnotations returns the annotations requested for the generated secret,
+// propagated shoot annotations are overridden by the ones of the config. Annotations with
+// an invalid key are skipped like invalid propagated shoot labels.
+func GenerateAnnotations(ctx context.Context, input *Input, info *Info) (map[string]string, error) {
+	annotations := map[string]string{}
+	for _, key := range input.S.Spec.PropagateShootAnnotations {
+		if value, ok := info.Annotations[key]; ok {
+			annotations[key] = value
+		}
+	}
+	if err := renderInto(annotations, input.S.Spec.Annotations, input, info); err != nil {
+		return nil, err
+	}
+	if input.S.Spec.DesiredOutput == "ArgoCD" && input.S.Spec.ArgoCD != nil {
+		if err := renderInto(annotations, input.S.Spec.ArgoCD.Annotations, input, info); err != nil {
+			return nil, err
+		}
+	}
+	for key := range annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			log.FromContext(ctx).Info(fmt.Sprintf("Skip annotation %s: %s", key, strings.Join(errs, ", ")))
+			delete(annotations, key)
+		}
+	}
+	return annotations, nil
+}
+
+// ManagedKeys returns the keys the operator recorded in one of the managed annotations
+func ManagedKeys(secret *v1.Secret, annotation string) []string {
+	value := secret.Annotations[annotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// RecordManagedKeys stores the label and annotation keys set by the operator on the secret
+func RecordManagedKeys(secret *v1.Secret, labels map[string]string, annotations map[string]string) {
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[ManagedLabelsAnnotation] = strings.Join(sortedKeys(labels), ",")
+
+	keys := []string{}
+	for _, k := range sortedKeys(annotations) {
+		if !strings.HasPrefix(k, "configs.customer.gardener/") {
+			keys = append(keys, k)
+		}
+	}
+	secret.Annotations[ManagedAnnotationsAnnotation] = strings.Join(keys, ",")
+}
+
+// render the values and add them to out, plain values are copied as they are
+func renderInto(out map[string]string, values map[string]string, input *Input, info *Info) error {
+	data := TemplateData{Config: input.S, Shoot: info}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+		if !strings.Contains(value, "{{") {
+			out[key] = value
+			continue
+		}
+		tmpl, err := template.New(key).Option("missingkey=zero").Parse(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse template of %s.\n%s -", key, err)
+		}
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return fmt.Errorf("unable to render template of %s.\n%s -", key, err)
+		}
+		out[key] = rendered.String()
+	}
+	return nil
+}
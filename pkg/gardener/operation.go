@@ -0,0 +1,50 @@
+package gardener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// shoot operations understood by gardener
+const (
+	operationAnnotation = "gardener.cloud/operation"
+	// starts the rotation of all shoot credentials including the CAs, the old client
+	// certificates stay valid until the rotation is completed with rotate-credentials-complete
+	OperationRotateCredentialsStart = "rotate-credentials-start"
+	// completes a credentials rotation once it is prepared, the old CAs and every client
+	// certificate signed by them become invalid
+	OperationRotateCredentialsComplete = "rotate-credentials-complete"
+)
+
+// StartShootOperation annotates the shoot with a gardener operation
+func StartShootOperation(ctx context.Context, project string, shoot string, operation string) error {
+	clientset, err := gardenClientset()
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{operationAnnotation: operation},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(ctx)
+	defer cancel()
+
+	_, err = clientset.RESTClient().
+		Patch(types.MergePatchType).
+		AbsPath(fmt.Sprintf("apis/core.gardener.cloud/v1beta1/namespaces/garden-%s/shoots/%s", project, shoot)).
+		Body(patch).
+		DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to start operation %s on shoot %s.\n%s -", operation, shoot, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package gardener
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"time"
@@ -10,86 +11,132 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// constant env kubeconfig for the seed
-// could not be only KUBECONFIG because then the normal controller SVC will be overridden
-const (
-	kubeConfigEnvName = "KUBECONFIG_REMOTE"
-)
-
 var secretMeta = metav1.TypeMeta{
 	APIVersion: "v1",
 	Kind:       "Secret",
 }
 
+// annotations the operator maintains on generated secrets
+const (
+	// hash over the secret content which is not rotated with the credentials
+	ContentHashAnnotation = "configs.customer.gardener/content-hash"
+	// time the credentials in the secret were issued
+	IssuedAtAnnotation = "configs.customer.gardener/issued-at"
+	// comma separated label keys set by the operator, used to remove them again
+	ManagedLabelsAnnotation = "configs.customer.gardener/managed-labels"
+	// comma separated annotation keys set by the operator, used to remove them again
+	ManagedAnnotationsAnnotation = "configs.customer.gardener/managed-annotations"
+)
+
+// SecretName returns the name of the secret generated for the config
+func SecretName(s *customergardenerv1.Config) string {
+	if s.Spec.DesiredOutput == "ArgoCD" {
+		return s.Spec.Shoot
+	}
+	return fmt.Sprintf("%s-plain", s.Spec.Shoot)
+}
+
+// IssuedAt returns the time the credentials of a generated secret were issued
+func IssuedAt(secret *v1.Secret) (time.Time, bool) {
+	issuedAt, err := time.Parse(time.RFC3339, secret.Annotations[IssuedAtAnnotation])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return issuedAt, true
+}
+
 type Input struct {
 	S *customergardenerv1.Config
+	// shoot info already fetched by the caller, read from the garden cluster if nil
+	Info *Info
+	// application controller shard assigned by the operator, the config shard is used if nil
+	Shard *int64
+	// mapping of the shoot to a stage, the default mapping is used if nil
+	Stages *StageMapping
+	// added to the frequency for the lifetime of the credentials to prevent reconciling gaps
+	SafetyMargin time.Duration
 }
 
 // generate a secret to define declarative a managed ArgoCD Cluster
-func GenerateSecret(input *Input) (*v1.Secret, string, error) {
-	// add 60 Seconds concurrency to prevent reconciling gaps
-	frequency := input.S.Spec.Frequency.Duration.Seconds() + (time.Duration(60) * time.Second).Seconds()
+func GenerateSecret(ctx context.Context, input *Input) (*v1.Secret, string, error) {
+	frequency := (input.S.Spec.Frequency.Duration + input.SafetyMargin).Seconds()
 
-	returendInfo, err := GetInfo(input.S.Spec.Project, input.S.Spec.Shoot)
+	returendInfo := input.Info
+	if returendInfo == nil {
+		info, err := GetInfo(ctx, input.S.Spec.Project, input.S.Spec.Shoot)
+		if err != nil {
+			return nil, "", err
+		}
+		returendInfo = info
+	}
+
+	returendData, err := GetConfig(ctx, input.S.Spec.Project, input.S.Spec.Shoot, int(frequency), input.S.Spec.DesiredOutput)
 	if err != nil {
 		return nil, "", err
 	}
 
-	returendData, err := GetConfig(input.S.Spec.Project, input.S.Spec.Shoot, int(frequency), input.S.Spec.DesiredOutput)
+	// while a CA rotation is running the kubeconfig only carries one CA,
+	// so the full bundle is used to trust the old and the new CA
+	var caBundle string
+	if CARotationInProgress(returendInfo.CARotationPhase) {
+		caBundle, err = getCABundle(ctx, input.S.Spec.Project, input.S.Spec.Shoot)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	labels, err := GenerateLabels(ctx, input, returendInfo)
+	if err != nil {
+		return nil, "", err
+	}
+	annotations, err := GenerateAnnotations(ctx, input, returendInfo)
 	if err != nil {
 		return nil, "", err
 	}
 
-	if input.S.Spec.DesiredOutput == "ArgoCD" {
-
-		// build labels if input is not empty
-		labels := map[string]string{
-			"argocd.argoproj.io/secret-type": "cluster",
-			"clustername":                    input.S.Spec.Shoot,
-		}
+	meta := metav1.ObjectMeta{
+		Namespace:   input.S.ObjectMeta.Namespace,
+		Name:        SecretName(input.S),
+		Labels:      labels,
+		Annotations: annotations,
+	}
+	meta.Annotations[IssuedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	meta.Annotations[customergardenerv1.OwnerAnnotation] = input.S.Name
 
-		if input.S.Spec.Stage != "" {
-			labels["stage"] = input.S.Spec.Stage
-		} else {
-			labels["stage"] = returendInfo[0]
-		}
-		if input.S.Spec.Stage != "" {
-			labels["cloudprovider"] = input.S.Spec.CloudProvider
-		} else {
-			labels["cloudprovider"] = returendInfo[1]
+	if input.S.Spec.DesiredOutput == "ArgoCD" {
+		if caBundle != "" {
+			returendData[0] = caBundle
 		}
 
 		// caData, clusterAddress, certData, keyData
-		argoConfig := fmt.Sprintf(`{"tlsClientConfig": {"caData": "%s", "certData": "%s", "keyData": "%s"}}`, returendData[0], returendData[2], returendData[3])
-		byteConfig := []byte(argoConfig)
-
-		byteClusterAddress := []byte(returendData[1])
-		byteShoot := []byte(input.S.Spec.Shoot)
+		data, err := ArgoCDClusterData(input, returendData[1], ArgoTLSClientConfig{
+			CaData:   returendData[0],
+			CertData: returendData[2],
+			KeyData:  returendData[3],
+		})
+		if err != nil {
+			return nil, "", err
+		}
 
 		return &v1.Secret{
-			TypeMeta: secretMeta,
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: input.S.ObjectMeta.Namespace,
-				Name:      input.S.Spec.Shoot,
-				Labels:    labels,
-			},
-			Data: map[string][]byte{
-				"name":   byteShoot,
-				"server": byteClusterAddress,
-				"config": byteConfig,
-			},
+			TypeMeta:   secretMeta,
+			ObjectMeta: meta,
+			Data:       data,
 		}, returendData[1], nil
 	} else {
+		if caBundle != "" {
+			returendData[0], err = replaceCAData(returendData[0], caBundle)
+			if err != nil {
+				return nil, "", err
+			}
+		}
 		decodedKubeConfig, _ := base64.StdEncoding.DecodeString(returendData[0])
 		return &v1.Secret{
-			TypeMeta: secretMeta,
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: input.S.ObjectMeta.Namespace,
-				Name:      fmt.Sprintf("%s-plain", input.S.Spec.Shoot),
-			},
+			TypeMeta:   secretMeta,
+			ObjectMeta: meta,
 			Data: map[string][]byte{
 				"kubeconfig": []byte(decodedKubeConfig),
 			},
-		}, returendData[1], nil
+		}, kubeconfigServer(decodedKubeConfig), nil
 	}
 }
@@ -0,0 +1,50 @@
+package gardener
+
+// StageMapping maps gardener purposes and shoot labels to the stage vocabulary of the
+// generated secrets. Label rules are checked in order before the purpose is mapped.
+type StageMapping struct {
+	// shoot labels whose value is used as stage
+	Labels []StageLabel `json:"labels,omitempty"`
+	// gardener purpose to stage
+	Purposes map[string]string `json:"purposes,omitempty"`
+	// stage of shoots matching no rule
+	Default string `json:"default,omitempty"`
+}
+
+// StageLabel takes the stage from a shoot label
+type StageLabel struct {
+	Key string `json:"key"`
+	// optional translation of the label value, the value is used as it is if missing
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// DefaultStageMapping keeps production shoots apart from all others
+func DefaultStageMapping() *StageMapping {
+	return &StageMapping{
+		Purposes: map[string]string{
+			"production": "prod",
+		},
+		Default: "dev",
+	}
+}
+
+// Stage returns the stage of the shoot, a nil mapping uses the default one
+func (m *StageMapping) Stage(info *Info) string {
+	if m == nil {
+		m = DefaultStageMapping()
+	}
+	for _, rule := range m.Labels {
+		value, ok := info.Labels[rule.Key]
+		if !ok || value == "" {
+			continue
+		}
+		if mapped, ok := rule.Values[value]; ok {
+			return mapped
+		}
+		return value
+	}
+	if stage, ok := m.Purposes[info.Purpose]; ok {
+		return stage
+	}
+	return m.Default
+}
@@ -0,0 +1,317 @@
+package operatorconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+	"customer.gardener/config/pkg/argocd"
+	"customer.gardener/config/pkg/gardener"
+)
+
+// version and kind of the operator configuration file
+const (
+	APIVersion = "config.customer.gardener/v1alpha1"
+	Kind       = "OperatorConfiguration"
+)
+
+// OperatorConfiguration holds the operator wide settings. The watched namespaces, the controller
+// concurrency and the audit sink are read once at startup, all other settings apply to the next
+// reconcile after a reload.
+type OperatorConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+	// namespaces watched by the manager, all namespaces if empty
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// connection to the garden cluster
+	Garden gardener.Connection `json:"garden"`
+	// concurrency of the controllers, read once at startup
+	Controller Controller `json:"controller"`
+	// timing of the credential rotation
+	Rotation Rotation `json:"rotation"`
+	// mapping of gardener purposes and shoot labels to stages
+	StageMapping *gardener.StageMapping `json:"stageMapping,omitempty"`
+	// assignment of ArgoCD application controller shards
+	Sharding argocd.Sharding `json:"sharding"`
+	// upper bounds of single requests to ArgoCD and Vault
+	Timeouts Timeouts `json:"timeouts"`
+	// where the audit trail of issued credentials goes: stdout, file:<path>, a http(s)
+	// webhook URL or none
+	AuditSink string `json:"auditSink,omitempty"`
+	// Vault logins configs may use with the service account of the operator
+	Vault Vault `json:"vault"`
+	// start a gardener credentials rotation of the shoot when credentials are revoked
+	RevokeRotatesShootCredentials bool `json:"revokeRotatesShootCredentials,omitempty"`
+	// defaults for the fields a Config leaves empty
+	Defaults Defaults `json:"defaults"`
+}
+
+// Controller holds the concurrency settings of the Config and ClusterConfig controllers
+type Controller struct {
+	// configs reconciled in parallel by each controller
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+}
+
+// Timeouts bound a single request to an external API, the request is cancelled earlier if the
+// reconcile is, e.g. on shutdown. The garden timeout is part of the garden connection.
+type Timeouts struct {
+	// requests to the ArgoCD API
+	ArgoCD *metav1.Duration `json:"argocd,omitempty"`
+	// requests to Vault
+	Vault *metav1.Duration `json:"vault,omitempty"`
+}
+
+// Vault limits the Vault kubernetes auth of configs. The login uses the service account of the
+// operator, so a config may only log in at the Vaults and with the roles listed here. A token
+// secret in the namespace of the config works with every Vault.
+type Vault struct {
+	KubernetesAuth []VaultKubernetesLogin `json:"kubernetesAuth,omitempty"`
+}
+
+// VaultKubernetesLogin allows the kubernetes auth at one Vault
+type VaultKubernetesLogin struct {
+	// the Vault address, e.g. https://vault.example.com:8200
+	Address string `json:"address"`
+	// mount path of the auth method, kubernetes if empty
+	MountPath string `json:"mountPath,omitempty"`
+	// roles configs may log in with
+	Roles []string `json:"roles"`
+}
+
+// AllowsKubernetesLogin reports whether a config may log in at the Vault address with the role
+func (v Vault) AllowsKubernetesLogin(address string, mountPath string, role string) bool {
+	for _, login := range v.KubernetesAuth {
+		if strings.TrimSuffix(login.Address, "/") != strings.TrimSuffix(address, "/") ||
+			vaultAuthMount(login.MountPath) != vaultAuthMount(mountPath) {
+			continue
+		}
+		for _, allowed := range login.Roles {
+			if allowed == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func vaultAuthMount(mountPath string) string {
+	if mountPath == "" {
+		return "kubernetes"
+	}
+	return strings.Trim(mountPath, "/")
+}
+
+// Rotation holds the margins around the token frequency of a config
+type Rotation struct {
+	// added to the lifetime of issued credentials so they outlive the next rotation
+	SafetyMargin *metav1.Duration `json:"safetyMargin,omitempty"`
+	// the rotation starts this long before the frequency is over
+	Skew *metav1.Duration `json:"skew,omitempty"`
+	// share of the frequency, between 0 and 0.5, by which the rotation of a config is brought
+	// forward at most. Each config gets a stable share so configs created together do not
+	// rotate at once.
+	Jitter *float64 `json:"jitter,omitempty"`
+	// retries of failed rotations
+	Retry Retry `json:"retry"`
+}
+
+// Retry is the backoff of failed rotations. The backoff grows exponentially while the current
+// credentials have headroom and shrinks as they approach their expiry.
+type Retry struct {
+	// backoff after the first failure, doubled with every further one
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+	// longest backoff
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+	// shortest backoff, used close to the expiry of the credentials
+	MinBackoff *metav1.Duration `json:"minBackoff,omitempty"`
+	// failed attempts tolerated before the rotation is reported at risk
+	Budget int32 `json:"budget,omitempty"`
+	// a failing rotation is reported at risk once the credentials expire within this window
+	CriticalWindow *metav1.Duration `json:"criticalWindow,omitempty"`
+}
+
+// Defaults are applied to a Config before it is reconciled, the Config itself is not changed
+type Defaults struct {
+	// token frequency of configs without one
+	Frequency *metav1.Duration `json:"frequency,omitempty"`
+	// labels and annotations of the generated secret, the ones of the config win
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ArgoCD output settings of configs without an argocd section
+	ArgoCD *customergardenerv1.ArgoCDOutput `json:"argocd,omitempty"`
+	// AppProject settings of configs without an appProject section
+	AppProject *customergardenerv1.AppProjectSpec `json:"appProject,omitempty"`
+}
+
+// Default returns the configuration used without a configuration file
+func DefaultConfiguration() *OperatorConfiguration {
+	c := &OperatorConfiguration{
+		TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind},
+	}
+	c.setDefaults()
+	return c
+}
+
+// environment variables of operator versions before the configuration file, they fill the
+// matching fields if the file leaves them empty
+const (
+	WatchNamespaceEnv   = "WATCH_NAMESPACE"
+	GardenKubeconfigEnv = "KUBECONFIG_REMOTE"
+)
+
+func (c *OperatorConfiguration) setDefaults() {
+	if len(c.WatchNamespaces) == 0 {
+		for _, ns := range strings.Split(os.Getenv(WatchNamespaceEnv), ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				c.WatchNamespaces = append(c.WatchNamespaces, ns)
+			}
+		}
+	}
+	if c.Garden.Kubeconfig == "" {
+		c.Garden.Kubeconfig = os.Getenv(GardenKubeconfigEnv)
+	}
+	if c.Rotation.SafetyMargin == nil {
+		c.Rotation.SafetyMargin = &metav1.Duration{Duration: 60 * time.Second}
+	}
+	if c.Rotation.Skew == nil {
+		c.Rotation.Skew = &metav1.Duration{Duration: time.Minute}
+	}
+	if c.Rotation.Jitter == nil {
+		jitter := 0.1
+		c.Rotation.Jitter = &jitter
+	}
+	retry := &c.Rotation.Retry
+	if retry.InitialBackoff == nil {
+		retry.InitialBackoff = &metav1.Duration{Duration: 30 * time.Second}
+	}
+	if retry.MaxBackoff == nil {
+		retry.MaxBackoff = &metav1.Duration{Duration: 30 * time.Minute}
+	}
+	if retry.MinBackoff == nil {
+		retry.MinBackoff = &metav1.Duration{Duration: 10 * time.Second}
+	}
+	if retry.Budget == 0 {
+		retry.Budget = 5
+	}
+	if retry.CriticalWindow == nil {
+		retry.CriticalWindow = &metav1.Duration{Duration: time.Hour}
+	}
+	if c.Garden.Timeout == nil {
+		c.Garden.Timeout = &metav1.Duration{Duration: 30 * time.Second}
+	}
+	if c.Timeouts.ArgoCD == nil {
+		c.Timeouts.ArgoCD = &metav1.Duration{Duration: 30 * time.Second}
+	}
+	if c.Timeouts.Vault == nil {
+		c.Timeouts.Vault = &metav1.Duration{Duration: 30 * time.Second}
+	}
+	if c.Controller.MaxConcurrentReconciles == 0 {
+		c.Controller.MaxConcurrentReconciles = 1
+	}
+	if c.StageMapping == nil {
+		c.StageMapping = gardener.DefaultStageMapping()
+	}
+	if c.Sharding.Strategy == "" {
+		c.Sharding.Strategy = argocd.ShardingHash
+	}
+	if c.AuditSink == "" {
+		c.AuditSink = "stdout"
+	}
+	if c.Defaults.Frequency == nil {
+		c.Defaults.Frequency = &metav1.Duration{Duration: 12 * time.Hour}
+	}
+}
+
+// Validate checks the settings of the configuration
+func (c *OperatorConfiguration) Validate() error {
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		return fmt.Errorf("unsupported configuration %s %s, expected %s %s", c.APIVersion, c.Kind, APIVersion, Kind)
+	}
+	if c.Rotation.SafetyMargin.Duration < 0 || c.Rotation.Skew.Duration < 0 {
+		return fmt.Errorf("rotation margins must not be negative")
+	}
+	if c.Defaults.Frequency.Duration <= c.Rotation.Skew.Duration {
+		return fmt.Errorf("default frequency %s must be longer than the rotation skew %s", c.Defaults.Frequency.Duration, c.Rotation.Skew.Duration)
+	}
+	if *c.Rotation.Jitter < 0 || *c.Rotation.Jitter > 0.5 {
+		return fmt.Errorf("rotation jitter must be between 0 and 0.5, got %v", *c.Rotation.Jitter)
+	}
+	if r := c.Rotation.Retry; r.MinBackoff.Duration <= 0 || r.InitialBackoff.Duration < r.MinBackoff.Duration ||
+		r.MaxBackoff.Duration < r.InitialBackoff.Duration {
+		return fmt.Errorf("retry backoffs must satisfy 0 < minBackoff <= initialBackoff <= maxBackoff")
+	}
+	if c.Rotation.Retry.Budget < 0 {
+		return fmt.Errorf("retry budget must not be negative")
+	}
+	if c.Controller.MaxConcurrentReconciles < 0 {
+		return fmt.Errorf("maxConcurrentReconciles must not be negative")
+	}
+	if c.Garden.QPS < 0 || c.Garden.Burst < 0 || c.Garden.AdminKubeconfigQPS < 0 || c.Garden.AdminKubeconfigBurst < 0 {
+		return fmt.Errorf("garden rate limits must not be negative")
+	}
+	if c.Garden.Timeout.Duration <= 0 || c.Timeouts.ArgoCD.Duration <= 0 || c.Timeouts.Vault.Duration <= 0 {
+		return fmt.Errorf("timeouts must be positive")
+	}
+	for _, login := range c.Vault.KubernetesAuth {
+		if login.Address == "" || len(login.Roles) == 0 {
+			return fmt.Errorf("vault kubernetesAuth entries need an address and roles")
+		}
+	}
+	return c.Sharding.Validate()
+}
+
+// Parse reads a configuration, unknown fields are refused
+func Parse(content []byte) (*OperatorConfiguration, error) {
+	c := &OperatorConfiguration{}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, fmt.Errorf("error on operator configuration Unmarshaling.\n%s -", err)
+	}
+	c.setDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads the configuration file, e.g. a mounted ConfigMap
+func Load(path string) (*OperatorConfiguration, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read operator configuration %s.\n%s -", path, err)
+	}
+	return Parse(content)
+}
+
+// Apply fills the empty fields of the config with the defaults, the config must be a copy
+// which is not written back to its spec
+func (d *Defaults) Apply(config *customergardenerv1.Config) {
+	if config.Spec.Frequency == nil && d.Frequency != nil {
+		config.Spec.Frequency = d.Frequency.DeepCopy()
+	}
+	config.Spec.Labels = mergeDefaults(d.Labels, config.Spec.Labels)
+	config.Spec.Annotations = mergeDefaults(d.Annotations, config.Spec.Annotations)
+	if config.Spec.ArgoCD == nil && d.ArgoCD != nil {
+		config.Spec.ArgoCD = d.ArgoCD.DeepCopy()
+	}
+	if config.Spec.AppProject == nil && d.AppProject != nil {
+		config.Spec.AppProject = d.AppProject.DeepCopy()
+	}
+}
+
+func mergeDefaults(defaults map[string]string, values map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return values
+	}
+	merged := make(map[string]string, len(defaults)+len(values))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
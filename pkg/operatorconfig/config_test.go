@@ -0,0 +1,150 @@
+package operatorconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	customergardenerv1 "customer.gardener/config/api/v1"
+)
+
+const sample = `apiVersion: config.customer.gardener/v1alpha1
+kind: OperatorConfiguration
+watchNamespaces: [argocd]
+garden:
+  kubeconfig: /kube/kubeconfig
+  qps: 5
+  burst: 10
+  timeout: 10s
+rotation:
+  skew: 2m
+stageMapping:
+  purposes:
+    production: live
+  default: test
+defaults:
+  frequency: 6h
+  labels:
+    team: platform
+`
+
+var _ = Describe("OperatorConfiguration", func() {
+	It("reads a configuration and fills the defaults", func() {
+		c, err := Parse([]byte(sample))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.WatchNamespaces).To(Equal([]string{"argocd"}))
+		Expect(c.Garden.Kubeconfig).To(Equal("/kube/kubeconfig"))
+		Expect(c.Garden.Burst).To(Equal(10))
+		Expect(c.Rotation.Skew.Duration).To(Equal(2 * time.Minute))
+		Expect(c.Rotation.SafetyMargin.Duration).To(Equal(60 * time.Second))
+		Expect(c.StageMapping.Purposes).To(HaveKeyWithValue("production", "live"))
+		Expect(c.Sharding.Strategy).To(Equal("hash"))
+		Expect(c.AuditSink).To(Equal("stdout"))
+		Expect(*c.Rotation.Jitter).To(Equal(0.1))
+		Expect(c.Controller.MaxConcurrentReconciles).To(Equal(1))
+		Expect(c.Rotation.Retry.Budget).To(Equal(int32(5)))
+		Expect(c.Rotation.Retry.MaxBackoff.Duration).To(Equal(30 * time.Minute))
+		Expect(c.Garden.Timeout.Duration).To(Equal(10 * time.Second))
+		Expect(c.Timeouts.ArgoCD.Duration).To(Equal(30 * time.Second))
+		Expect(c.Timeouts.Vault.Duration).To(Equal(30 * time.Second))
+	})
+
+	It("refuses unknown fields, versions and invalid settings", func() {
+		_, err := Parse([]byte(sample + "unknown: true\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = Parse([]byte("apiVersion: config.customer.gardener/v2\nkind: OperatorConfiguration\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = Parse([]byte("apiVersion: config.customer.gardener/v1alpha1\nkind: OperatorConfiguration\nsharding:\n  strategy: random\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = Parse([]byte("apiVersion: config.customer.gardener/v1alpha1\nkind: OperatorConfiguration\nrotation:\n  jitter: 0.8\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = Parse([]byte("apiVersion: config.customer.gardener/v1alpha1\nkind: OperatorConfiguration\ntimeouts:\n  argocd: 0s\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("falls back to the environment of older versions", func() {
+		Expect(os.Setenv(WatchNamespaceEnv, "argocd, team-a")).To(Succeed())
+		Expect(os.Setenv(GardenKubeconfigEnv, "/kube/legacy")).To(Succeed())
+		DeferCleanup(func() {
+			Expect(os.Unsetenv(WatchNamespaceEnv)).To(Succeed())
+			Expect(os.Unsetenv(GardenKubeconfigEnv)).To(Succeed())
+		})
+
+		c := DefaultConfiguration()
+		Expect(c.WatchNamespaces).To(Equal([]string{"argocd", "team-a"}))
+		Expect(c.Garden.Kubeconfig).To(Equal("/kube/legacy"))
+
+		// the configuration file wins
+		c, err := Parse([]byte(sample))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.WatchNamespaces).To(Equal([]string{"argocd"}))
+		Expect(c.Garden.Kubeconfig).To(Equal("/kube/kubeconfig"))
+	})
+
+	It("allows the Vault kubernetes auth only at the listed Vaults and roles", func() {
+		v := Vault{KubernetesAuth: []VaultKubernetesLogin{{Address: "https://vault.example.com:8200/", Roles: []string{"gardener-config"}}}}
+		Expect(v.AllowsKubernetesLogin("https://vault.example.com:8200", "", "gardener-config")).To(BeTrue())
+		Expect(v.AllowsKubernetesLogin("https://vault.example.com:8200", "kubernetes", "gardener-config")).To(BeTrue())
+		Expect(v.AllowsKubernetesLogin("https://vault.example.com:8200", "", "admin")).To(BeFalse())
+		Expect(v.AllowsKubernetesLogin("https://attacker.example.com", "", "gardener-config")).To(BeFalse())
+		Expect(v.AllowsKubernetesLogin("https://vault.example.com:8200", "k8s-prod", "gardener-config")).To(BeFalse())
+		Expect(Vault{}.AllowsKubernetesLogin("https://vault.example.com:8200", "", "gardener-config")).To(BeFalse())
+
+		_, err := Parse([]byte(sample + "vault:\n  kubernetesAuth:\n  - address: https://vault.example.com\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fills empty fields of a config only", func() {
+		c, err := Parse([]byte(sample))
+		Expect(err).NotTo(HaveOccurred())
+		config := &customergardenerv1.Config{Spec: customergardenerv1.ConfigSpec{
+			Labels: map[string]string{"team": "abc", "stage": "dev"},
+		}}
+		c.Defaults.Apply(config)
+		Expect(config.Spec.Frequency.Duration).To(Equal(6 * time.Hour))
+		Expect(config.Spec.Labels).To(Equal(map[string]string{"team": "abc", "stage": "dev"}))
+
+		config.Spec.Frequency = &metav1.Duration{Duration: time.Hour}
+		c.Defaults.Apply(config)
+		Expect(config.Spec.Frequency.Duration).To(Equal(time.Hour))
+	})
+
+	It("reloads a changed file and keeps the configuration on errors", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(sample), 0o600)).To(Succeed())
+		initial, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		store := NewStore(initial)
+		reloaded := make(chan *OperatorConfiguration, 1)
+		w := NewWatcher(path, 10*time.Millisecond, store, func(c *OperatorConfiguration) { reloaded <- c })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = w.Start(ctx) }()
+
+		Expect(os.WriteFile(path, []byte(sample+"revokeRotatesShootCredentials: true\n"), 0o600)).To(Succeed())
+		Eventually(reloaded).Should(Receive())
+		Expect(store.Get().RevokeRotatesShootCredentials).To(BeTrue())
+
+		Expect(os.WriteFile(path, []byte("kind: [\n"), 0o600)).To(Succeed())
+		Consistently(reloaded, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(store.Get().RevokeRotatesShootCredentials).To(BeTrue())
+	})
+
+	It("names the changed fields which need a restart", func() {
+		running := DefaultConfiguration()
+		loaded := DefaultConfiguration()
+		loaded.RevokeRotatesShootCredentials = true
+		Expect(RestartFields(running, loaded)).To(BeEmpty())
+
+		loaded.WatchNamespaces = []string{"argocd"}
+		loaded.Controller.MaxConcurrentReconciles = running.Controller.MaxConcurrentReconciles + 1
+		loaded.AuditSink = "none"
+		Expect(RestartFields(running, loaded)).To(ConsistOf("watchNamespaces", "controller.maxConcurrentReconciles", "auditSink"))
+	})
+})
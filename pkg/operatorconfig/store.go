@@ -0,0 +1,113 @@
+package operatorconfig
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Store hands out the current configuration, it is swapped as a whole on a reload
+type Store struct {
+	mu     sync.RWMutex
+	config *OperatorConfiguration
+}
+
+// NewStore returns a store holding config
+func NewStore(config *OperatorConfiguration) *Store {
+	return &Store{config: config}
+}
+
+// Get returns the current configuration, the default one for a nil store. The result must
+// not be changed.
+func (s *Store) Get() *OperatorConfiguration {
+	if s == nil {
+		return DefaultConfiguration()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Set replaces the configuration
+func (s *Store) Set(config *OperatorConfiguration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+}
+
+// Watcher reloads the configuration file whenever its content changes. A ConfigMap mounted as
+// volume is updated by the kubelet, so a changed ConfigMap reaches the operator without a restart.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	store    *Store
+	onReload func(*OperatorConfiguration)
+	content  []byte
+	// the configuration the process started with
+	initial *OperatorConfiguration
+}
+
+// NewWatcher returns a watcher for the file the store was loaded from, onReload is called with
+// every configuration loaded afterwards
+func NewWatcher(path string, interval time.Duration, store *Store, onReload func(*OperatorConfiguration)) *Watcher {
+	content, _ := os.ReadFile(path)
+	return &Watcher{path: path, interval: interval, store: store, onReload: onReload, content: content, initial: store.Get()}
+}
+
+// RestartFields returns the fields of the configuration which differ from the running one but
+// are only read at startup, they take effect with the next restart of the operator
+func RestartFields(running, loaded *OperatorConfiguration) []string {
+	var fields []string
+	if !reflect.DeepEqual(running.WatchNamespaces, loaded.WatchNamespaces) {
+		fields = append(fields, "watchNamespaces")
+	}
+	if running.Controller.MaxConcurrentReconciles != loaded.Controller.MaxConcurrentReconciles {
+		fields = append(fields, "controller.maxConcurrentReconciles")
+	}
+	if running.AuditSink != loaded.AuditSink {
+		fields = append(fields, "auditSink")
+	}
+	return fields
+}
+
+// Start polls the file until ctx is done, an invalid file keeps the previous configuration
+func (w *Watcher) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("operator-config")
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		content, err := os.ReadFile(w.path)
+		if err != nil || bytes.Equal(content, w.content) {
+			continue
+		}
+		w.content = content
+		config, err := Parse(content)
+		if err != nil {
+			logger.Error(err, "Keep the previous operator configuration")
+			continue
+		}
+		w.store.Set(config)
+		if w.onReload != nil {
+			w.onReload(config)
+		}
+		logger.Info("Reloaded operator configuration", "path", w.path)
+		if fields := RestartFields(w.initial, config); len(fields) > 0 {
+			logger.Info("Changed fields take effect after a restart of the operator", "fields", fields)
+		}
+	}
+}
+
+// NeedLeaderElection lets every replica follow the configuration, not only the leader
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to the HTTP API of a HashiCorp Vault server
+type Client struct {
+	Address string
+	// Vault enterprise namespace, empty for the root namespace
+	Namespace string
+	Token     string
+	HTTP      *http.Client
+}
+
+// NewClient returns a client for the Vault at address, caBundle is an optional PEM encoded CA
+func NewClient(address string, namespace string, caBundle string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, fmt.Errorf("no certificate found in the Vault CA bundle")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &Client{
+		Address:   strings.TrimSuffix(address, "/"),
+		Namespace: namespace,
+		HTTP:      &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// LoginKubernetes authenticates with a service account token at the kubernetes auth method
+// mounted at mountPath and keeps the returned token for later requests
+func (c *Client) LoginKubernetes(ctx context.Context, mountPath string, role string, jwt string) error {
+	body := map[string]string{"role": role, "jwt": jwt}
+	resp := struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}{}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("auth/%s/login", strings.Trim(mountPath, "/")), body, &resp); err != nil {
+		return fmt.Errorf("unable to login at Vault.\n%s -", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return fmt.Errorf("vault login returned no token")
+	}
+	c.Token = resp.Auth.ClientToken
+	return nil
+}
+
+// WriteKV stores data as new version of the KV v2 secret at mount/path and returns the version
+func (c *Client) WriteKV(ctx context.Context, mount string, path string, data map[string]string) (int64, error) {
+	body := map[string]interface{}{"data": data}
+	resp := struct {
+		Data struct {
+			Version int64 `json:"version"`
+		} `json:"data"`
+	}{}
+	if err := c.do(ctx, http.MethodPost, kvPath(mount, "data", path), body, &resp); err != nil {
+		return 0, fmt.Errorf("unable to write Vault secret %s/%s.\n%s -", mount, path, err)
+	}
+	return resp.Data.Version, nil
+}
+
+// WriteMetadata sets the custom metadata of the KV v2 secret at mount/path
+func (c *Client) WriteMetadata(ctx context.Context, mount string, path string, metadata map[string]string) error {
+	body := map[string]interface{}{"custom_metadata": metadata}
+	if err := c.do(ctx, http.MethodPost, kvPath(mount, "metadata", path), body, nil); err != nil {
+		return fmt.Errorf("unable to write metadata of Vault secret %s/%s.\n%s -", mount, path, err)
+	}
+	return nil
+}
+
+// ReadKV returns the latest version of the KV v2 secret at mount/path
+func (c *Client) ReadKV(ctx context.Context, mount string, path string) (map[string]string, error) {
+	resp := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, kvPath(mount, "data", path), nil, &resp); err != nil {
+		return nil, fmt.Errorf("unable to read Vault secret %s/%s.\n%s -", mount, path, err)
+	}
+	return resp.Data.Data, nil
+}
+
+// DeleteKV removes all versions and the metadata of the KV v2 secret at mount/path,
+// a missing secret is no error
+func (c *Client) DeleteKV(ctx context.Context, mount string, path string) error {
+	err := c.do(ctx, http.MethodDelete, kvPath(mount, "metadata", path), nil, nil)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to delete Vault secret %s/%s.\n%s -", mount, path, err)
+	}
+	return nil
+}
+
+// ResponseError is returned for non successful Vault responses
+type ResponseError struct {
+	StatusCode int
+	Errors     []string `json:"errors"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("vault responded %d: %s", e.StatusCode, strings.Join(e.Errors, ", "))
+}
+
+// IsNotFound reports whether Vault answered with 404
+func IsNotFound(err error) bool {
+	respErr, ok := err.(*ResponseError)
+	return ok && respErr.StatusCode == http.StatusNotFound
+}
+
+func kvPath(mount string, kind string, path string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.Trim(mount, "/"), kind, strings.Trim(path, "/"))
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/v1/%s", c.Address, path), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Vault-Token", c.Token)
+	}
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respErr := &ResponseError{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(content, respErr)
+		return respErr
+	}
+	if out != nil && len(content) > 0 {
+		return json.Unmarshal(content, out)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var c *Client
+	var path string
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		if os.Getenv("SKIP_VAULT") == "true" {
+			Skip("SKIP_VAULT set, no Vault dev server to test against")
+		}
+		address := os.Getenv("VAULT_ADDR")
+		Expect(address).NotTo(BeEmpty(), "set VAULT_ADDR and VAULT_TOKEN of a Vault dev server or SKIP_VAULT=true")
+		var err error
+		c, err = NewClient(address, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		c.Token = os.Getenv("VAULT_TOKEN")
+		path = fmt.Sprintf("gardener-config-operator-test/%d", time.Now().UnixNano())
+	})
+
+	AfterEach(func() {
+		if c != nil {
+			Expect(c.DeleteKV(ctx, "secret", path)).To(Succeed())
+		}
+	})
+
+	It("rotates a secret in place", func() {
+		version, err := c.WriteKV(ctx, "secret", path, map[string]string{"kubeconfig": "first"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.WriteMetadata(ctx, "secret", path, map[string]string{"shoot": "test"})).To(Succeed())
+
+		next, err := c.WriteKV(ctx, "secret", path, map[string]string{"kubeconfig": "second"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(version + 1))
+
+		data, err := c.ReadKV(ctx, "secret", path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("kubeconfig", "second"))
+	})
+
+	It("deletes all versions of a secret", func() {
+		_, err := c.WriteKV(ctx, "secret", path, map[string]string{"kubeconfig": "first"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.DeleteKV(ctx, "secret", path)).To(Succeed())
+		_, err = c.ReadKV(ctx, "secret", path)
+		Expect(err).To(HaveOccurred())
+
+		// deleting a missing secret is fine
+		Expect(c.DeleteKV(ctx, "secret", path)).To(Succeed())
+	})
+})